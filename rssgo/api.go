@@ -0,0 +1,411 @@
+// api.go serves a JSON API for reading and changing the store
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAPILimit is the page size of GET /api/items unless ?limit= asks
+// otherwise
+const defaultAPILimit = 50
+
+// refreshTimeout bounds a refresh triggered through the API
+const refreshTimeout = 60 * time.Second
+
+// apiServer handles the /api/ endpoints of rss serve
+type apiServer struct {
+	store   *FeedStore
+	fetcher *Fetcher
+	token   string // bearer token required on every request when set
+}
+
+// itemPage is the response of GET /api/items
+type itemPage struct {
+	Items  []FeedItem `json:"items"`
+	Total  int        `json:"total"` // matching items before pagination
+	Offset int        `json:"offset"`
+	Limit  int        `json:"limit"`
+	Next   string     `json:"next,omitempty"` // cursor for the following page
+}
+
+// itemPatch is the body of PATCH /api/items/{id}; absent fields are left
+// unchanged
+type itemPatch struct {
+	Read    *bool    `json:"read"`
+	Starred *bool    `json:"starred"`
+	Tags    []string `json:"tags"` // as for rss tag: "name" adds, "-name" removes
+}
+
+// feedPatch is the body of PATCH /api/feeds/{url}; absent fields are left
+// unchanged
+type feedPatch struct {
+	URL      string  `json:"url"` // move the subscription to a new URL
+	Title    *string `json:"title"`
+	Dead     *bool   `json:"dead"`      // false resumes fetching a dead feed
+	FullText *bool   `json:"full_text"` // fetch the linked article of new items
+}
+
+// refreshResult is the response of the refresh endpoints
+type refreshResult struct {
+	Feeds map[string]int `json:"feeds"` // items fetched per feed URL
+	Error string         `json:"error,omitempty"`
+}
+
+// ServeHTTP checks the bearer token and routes the request
+func (a *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.token != "" {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rss"`)
+			apiError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+	}
+
+	// Work on the escaped path so item IDs and feed URLs may contain
+	// slashes when percent-encoded
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/api/"), "/")
+	for i := range parts {
+		p, err := url.PathUnescape(parts[i])
+		if err != nil {
+			apiError(w, http.StatusBadRequest, "invalid path")
+			return
+		}
+		parts[i] = p
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "items":
+		a.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet: a.listItems,
+		})
+	case len(parts) == 2 && parts[0] == "items":
+		a.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:   func(w http.ResponseWriter, r *http.Request) { a.getItem(w, parts[1]) },
+			http.MethodPatch: func(w http.ResponseWriter, r *http.Request) { a.patchItem(w, r, parts[1]) },
+		})
+	case len(parts) == 1 && parts[0] == "refresh":
+		a.route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { a.refresh(w, r, a.store.Subscriptions()) },
+		})
+	case len(parts) == 1 && parts[0] == "feeds":
+		a.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:  a.listFeeds,
+			http.MethodPost: a.addFeed,
+		})
+	case len(parts) == 2 && parts[0] == "feeds":
+		a.route(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { a.getFeed(w, parts[1]) },
+			http.MethodPatch:  func(w http.ResponseWriter, r *http.Request) { a.patchFeed(w, r, parts[1]) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { a.deleteFeed(w, r, parts[1]) },
+		})
+	case len(parts) == 3 && parts[0] == "feeds" && parts[2] == "refresh":
+		a.route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := a.store.MetaFor(parts[1]); !ok {
+					apiError(w, http.StatusNotFound, "unknown feed")
+					return
+				}
+				a.refresh(w, r, []string{parts[1]})
+			},
+		})
+	default:
+		apiError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// route dispatches r to the handler for its method
+func (a *apiServer) route(w http.ResponseWriter, r *http.Request, handlers map[string]http.HandlerFunc) {
+	h, ok := handlers[r.Method]
+	if !ok {
+		methods := make([]string, 0, len(handlers))
+		for m := range handlers {
+			methods = append(methods, m)
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	h(w, r)
+}
+
+// listItems serves GET /api/items?feed=&tag=&q=&unread=&since=&until=&sort=&limit=&offset=&cursor=,
+// newest first
+func (a *apiServer) listItems(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := ListOptions{
+		Feed:    q.Get("feed"),
+		Tags:    q["tag"],
+		Query:   q.Get("q"),
+		Sort:    q.Get("sort"),
+		Cursor:  q.Get("cursor"),
+		Reverse: true,
+	}
+	if err := checkSortKey(opts.Sort); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var err error
+	if v := q.Get("unread"); v != "" {
+		if opts.Unread, err = strconv.ParseBool(v); err != nil {
+			apiError(w, http.StatusBadRequest, "invalid unread")
+			return
+		}
+	}
+	window, err := parseSinceUntil(q.Get("since"), q.Get("until"), time.Now())
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Since, opts.Until = window.From, window.Until
+	limit, ok := queryInt(w, q, "limit", defaultAPILimit)
+	if !ok {
+		return
+	}
+	offset, ok := queryInt(w, q, "offset", 0)
+	if !ok {
+		return
+	}
+
+	opts.Limit, opts.Offset = limit, offset
+	result := a.store.Page(opts)
+	page := itemPage{Items: result.Items, Total: result.Total, Offset: offset, Limit: limit, Next: result.Next}
+	if page.Items == nil {
+		page.Items = []FeedItem{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// getItem serves GET /api/items/{id}
+func (a *apiServer) getItem(w http.ResponseWriter, ref string) {
+	item, err := a.store.Find(ref)
+	if err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// patchItem serves PATCH /api/items/{id}
+func (a *apiServer) patchItem(w http.ResponseWriter, r *http.Request, ref string) {
+	var patch itemPatch
+	if !readJSON(w, r, &patch) {
+		return
+	}
+
+	if _, err := a.store.Find(ref); err != nil {
+		apiError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	item, err := a.store.Update(ref, func(item *FeedItem) {
+		if patch.Read != nil {
+			item.Read = *patch.Read
+		}
+		if patch.Starred != nil {
+			item.Starred = *patch.Starred
+		}
+		if len(patch.Tags) > 0 {
+			item.Tags = editTags(item.Tags, patch.Tags)
+		}
+	})
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// refresh fetches urls and reports the item counts
+func (a *apiServer) refresh(w http.ResponseWriter, r *http.Request, urls []string) {
+	ctx, cancel := context.WithTimeout(r.Context(), refreshTimeout)
+	defer cancel()
+
+	// Only this call's counts: a feed that fails now is left out even if
+	// an earlier refresh fetched it
+	counts, err := a.fetcher.FetchCounts(ctx, urls)
+	res := refreshResult{Feeds: counts}
+
+	status := http.StatusOK
+	if err != nil {
+		res.Error = redact(err.Error())
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, res)
+}
+
+// listFeeds serves GET /api/feeds
+func (a *apiServer) listFeeds(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.store.Meta())
+}
+
+// addFeed serves POST /api/feeds with a body of {"url": "...", "title": "..."}
+func (a *apiServer) addFeed(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if err := validateFeedURL(body.URL); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, ok := a.store.MetaFor(body.URL); ok {
+		apiError(w, http.StatusConflict, "already subscribed")
+		return
+	}
+
+	err := a.store.UpdateMeta(body.URL, func(m *FeedMeta) {
+		m.Title = body.Title
+	})
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	m, _ := a.store.MetaFor(body.URL)
+	w.Header().Set("Location", "/api/feeds/"+url.PathEscape(body.URL))
+	writeJSON(w, http.StatusCreated, m)
+}
+
+// getFeed serves GET /api/feeds/{url}
+func (a *apiServer) getFeed(w http.ResponseWriter, feed string) {
+	m, ok := a.store.MetaFor(feed)
+	if !ok {
+		apiError(w, http.StatusNotFound, "unknown feed")
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// patchFeed serves PATCH /api/feeds/{url}
+func (a *apiServer) patchFeed(w http.ResponseWriter, r *http.Request, feed string) {
+	var patch feedPatch
+	if !readJSON(w, r, &patch) {
+		return
+	}
+	if _, ok := a.store.MetaFor(feed); !ok {
+		apiError(w, http.StatusNotFound, "unknown feed")
+		return
+	}
+
+	// Check the whole patch before changing anything
+	if patch.URL != "" && patch.URL != feed {
+		if err := validateFeedURL(patch.URL); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, ok := a.store.MetaFor(patch.URL); ok {
+			apiError(w, http.StatusConflict, "already subscribed to "+patch.URL)
+			return
+		}
+		if err := a.store.MoveFeed(feed, patch.URL); err != nil {
+			apiError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		feed = patch.URL
+	}
+
+	err := a.store.UpdateMeta(feed, func(m *FeedMeta) {
+		if patch.Title != nil {
+			m.Title = *patch.Title
+		}
+		if patch.Dead != nil {
+			m.Dead = *patch.Dead
+			if m.Dead && m.DeadSince.IsZero() {
+				m.DeadSince = time.Now()
+			} else if !m.Dead {
+				enableFeed(m)
+			}
+		}
+		if patch.FullText != nil {
+			m.FullText = *patch.FullText
+		}
+	})
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	m, _ := a.store.MetaFor(feed)
+	writeJSON(w, http.StatusOK, m)
+}
+
+// deleteFeed serves DELETE /api/feeds/{url}; ?purge=true also deletes the
+// feed's items
+func (a *apiServer) deleteFeed(w http.ResponseWriter, r *http.Request, feed string) {
+	purge, _ := strconv.ParseBool(r.URL.Query().Get("purge"))
+	if _, ok := a.store.MetaFor(feed); !ok {
+		apiError(w, http.StatusNotFound, "unknown feed")
+		return
+	}
+	if err := a.store.RemoveFeed(feed, purge); err != nil {
+		apiError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateFeedURL checks that u is an absolute http or https URL
+func validateFeedURL(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// queryInt reads a non-negative integer parameter, answering 400 if it is
+// malformed
+func queryInt(w http.ResponseWriter, q url.Values, name string, def int) (int, bool) {
+	v := q.Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		apiError(w, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return n, true
+}
+
+// readJSON decodes the request body into v, answering 400 if it is
+// malformed
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			err = fmt.Errorf("malformed JSON at offset %d", syntaxErr.Offset)
+		}
+		apiError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// apiError writes an error response of the form {"error": "..."}
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// apiDo sends a request to the API and decodes the JSON response into v
+// when v is non-nil
+func apiDo(t *testing.T, api *apiServer, method, path, body string, v any) int {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, w.Body)
+		}
+	}
+	return w.Code
+}
+
+// feedPath returns the API path of a feed URL
+func feedPath(u string) string {
+	return "/api/feeds/" + url.PathEscape(u)
+}
+
+func TestAPIPatchFeedChecksBeforeWriting(t *testing.T) {
+	store := newTestStore(t, 10)
+	const a, b = "https://a.test/feed.xml", "https://b.test/feed.xml"
+	for _, u := range []string{a, b} {
+		if err := store.UpdateMeta(u, func(m *FeedMeta) { m.Title = "old" }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api := &apiServer{store: store}
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"title": "new", "url": "ftp://a.test/feed.xml"}`, http.StatusBadRequest},
+		{`{"title": "new", "dead": true, "url": "` + b + `"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if code := apiDo(t, api, http.MethodPatch, feedPath(a), tt.body, nil); code != tt.want {
+			t.Errorf("PATCH %s: status %d, want %d", tt.body, code, tt.want)
+		}
+		if m, ok := store.MetaFor(a); !ok || m.Title != "old" || m.Dead {
+			t.Errorf("PATCH %s changed the feed: %+v", tt.body, m)
+		}
+	}
+
+	const c = "https://c.test/feed.xml"
+	var m FeedMeta
+	if code := apiDo(t, api, http.MethodPatch, feedPath(a), `{"title": "new", "url": "`+c+`"}`, &m); code != http.StatusOK {
+		t.Fatalf("valid move: status %d", code)
+	}
+	if m.URL != c || m.Title != "new" {
+		t.Errorf("moved feed = %+v, want %s titled new", m, c)
+	}
+	if _, ok := store.MetaFor(a); ok {
+		t.Error("old URL still subscribed")
+	}
+}
+
+func TestAPIRefreshCountsThisCall(t *testing.T) {
+	// The feed works once, then fails
+	feed, err := os.ReadFile(filepath.Join("testdata", "feeds", "rss2.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		w.Write(feed)
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t, 10)
+	if err := store.UpdateMeta(srv.URL, func(m *FeedMeta) {}); err != nil {
+		t.Fatal(err)
+	}
+	api := &apiServer{store: store, fetcher: NewFetcher(store)}
+
+	var res refreshResult
+	if code := apiDo(t, api, http.MethodPost, "/api/refresh", "", &res); code != http.StatusOK || res.Feeds[srv.URL] != 3 {
+		t.Fatalf("first refresh: status %d, %+v", code, res)
+	}
+	res = refreshResult{}
+	code := apiDo(t, api, http.MethodPost, "/api/refresh", "", &res)
+	if code != http.StatusBadGateway || res.Error == "" {
+		t.Errorf("failing refresh: status %d, %+v", code, res)
+	}
+	if n, ok := res.Feeds[srv.URL]; ok {
+		t.Errorf("failing refresh reports %d items from the earlier one", n)
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	api := &apiServer{store: newTestStore(t, 10), token: "s3cret"}
+	tests := []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: status %d, want %d", tt.auth, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAPIListItems(t *testing.T) {
+	store := newTestStore(t, 10)
+	if _, err := store.Add([]FeedItem{testItem("Go", 1), testItem("Go", 2), testItem("News", 3)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Update("Go-1", func(item *FeedItem) { item.Read = true }); err != nil {
+		t.Fatal(err)
+	}
+	api := &apiServer{store: store}
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+		total  int
+	}{
+		{"", 200, []string{"News-3", "Go-2", "Go-1"}, 3},
+		{"?feed=Go", 200, []string{"Go-2", "Go-1"}, 2},
+		{"?unread=true", 200, []string{"News-3", "Go-2"}, 2},
+		{"?limit=1&offset=1", 200, []string{"Go-2"}, 3},
+		{"?feed=Nothing", 200, []string{}, 0},
+		{"?limit=-1", 400, nil, 0},
+		{"?offset=x", 400, nil, 0},
+		{"?unread=maybe", 400, nil, 0},
+		{"?sort=colour", 400, nil, 0},
+	}
+	for _, tt := range tests {
+		var page itemPage
+		code := apiDo(t, api, http.MethodGet, "/api/items"+tt.query, "", &page)
+		if code != tt.status {
+			t.Errorf("GET /api/items%s: status %d, want %d", tt.query, code, tt.status)
+			continue
+		}
+		if tt.status != 200 {
+			continue
+		}
+		if got := ids(page.Items); strings.Join(got, ",") != strings.Join(tt.want, ",") || page.Total != tt.total {
+			t.Errorf("GET /api/items%s = %v (total %d), want %v (total %d)", tt.query, got, page.Total, tt.want, tt.total)
+		}
+	}
+}
+
+func TestAPIPatchItem(t *testing.T) {
+	store := newTestStore(t, 10)
+	if _, err := store.Add([]FeedItem{testItem("Go", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	api := &apiServer{store: store}
+
+	var item FeedItem
+	body := `{"read": true, "starred": true, "tags": ["work", "later"]}`
+	if code := apiDo(t, api, http.MethodPatch, "/api/items/Go-1", body, &item); code != http.StatusOK {
+		t.Fatalf("PATCH: status %d", code)
+	}
+	if !item.Read || !item.Starred || strings.Join(item.Tags, ",") != "later,work" {
+		t.Errorf("patched item = %+v", item)
+	}
+	if code := apiDo(t, api, http.MethodPatch, "/api/items/Go-1", `{"tags": ["-work"]}`, &item); code != http.StatusOK {
+		t.Fatalf("PATCH tags: status %d", code)
+	}
+	if !item.Read || strings.Join(item.Tags, ",") != "later" {
+		t.Errorf("after removing a tag = %+v", item)
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPatch, "/api/items/Missing-1", `{"read": true}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/items/Go-1", `{"read": "yes"}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/items/Go-1", `{"colour": "red"}`, http.StatusBadRequest},
+		{http.MethodPatch, "/api/items/Go-1", `{`, http.StatusBadRequest},
+		{http.MethodGet, "/api/items/Missing-1", "", http.StatusNotFound},
+		{http.MethodDelete, "/api/items/Go-1", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/nothing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := apiDo(t, api, tt.method, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s %s %s: status %d, want %d", tt.method, tt.path, tt.body, code, tt.want)
+		}
+	}
+}
+
+func TestAPIFeeds(t *testing.T) {
+	store := newTestStore(t, 10)
+	api := &apiServer{store: store}
+	const u = "https://a.test/feed.xml"
+
+	var m FeedMeta
+	if code := apiDo(t, api, http.MethodPost, "/api/feeds", `{"url": "`+u+`", "title": "A"}`, &m); code != http.StatusCreated {
+		t.Fatalf("POST: status %d", code)
+	}
+	if m.URL != u || m.Title != "A" {
+		t.Errorf("added feed = %+v", m)
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/feeds", `{"url": "` + u + `"}`, http.StatusConflict},
+		{http.MethodPost, "/api/feeds", `{"url": "file:///etc/passwd"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/feeds", `{"url": "/relative"}`, http.StatusBadRequest},
+		{http.MethodGet, feedPath(u), "", http.StatusOK},
+		{http.MethodGet, feedPath("https://b.test/"), "", http.StatusNotFound},
+		{http.MethodPatch, feedPath(u), `{"full_text": true}`, http.StatusOK},
+		{http.MethodPost, feedPath("https://b.test/") + "/refresh", "", http.StatusNotFound},
+		{http.MethodDelete, feedPath(u), "", http.StatusNoContent},
+		{http.MethodDelete, feedPath(u), "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := apiDo(t, api, tt.method, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s %s %s: status %d, want %d", tt.method, tt.path, tt.body, code, tt.want)
+		}
+	}
+	var feeds []FeedMeta
+	if code := apiDo(t, api, http.MethodGet, "/api/feeds", "", &feeds); code != http.StatusOK || len(feeds) != 0 {
+		t.Errorf("GET /api/feeds after delete: status %d, %d feeds", code, len(feeds))
+	}
+}
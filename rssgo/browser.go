@@ -0,0 +1,54 @@
+// browser.go opens links in the user's browser
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// browserCommand returns the command that opens url: $BROWSER if set,
+// otherwise the platform's default opener
+func browserCommand(url string) *exec.Cmd {
+	// $BROWSER may hold a colon-separated list; use the first non-empty
+	// entry, substituting %s if present as the convention allows
+	for _, browser := range strings.Split(os.Getenv("BROWSER"), string(os.PathListSeparator)) {
+		args := strings.Fields(browser)
+		if len(args) == 0 {
+			continue
+		}
+		if strings.Contains(browser, "%s") {
+			for i := range args {
+				args[i] = strings.ReplaceAll(args[i], "%s", url)
+			}
+		} else {
+			args = append(args, url)
+		}
+		return exec.Command(args[0], args[1:]...)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url)
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		return exec.Command("xdg-open", url)
+	}
+}
+
+// openBrowser starts the browser on url without waiting for it to exit
+func openBrowser(url string) error {
+	if url == "" {
+		return fmt.Errorf("item has no link")
+	}
+	cmd := browserCommand(url)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("opening browser: %w", err)
+	}
+	// Reap the process in the background
+	go cmd.Wait()
+	return nil
+}
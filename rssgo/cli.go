@@ -0,0 +1,453 @@
+// cli.go builds the command line: ffcli subcommands that each fetch, list
+// or manage the store, and a root command that keeps the flag-driven
+// behaviour of earlier versions for existing scripts
+package main
+
+import (
+	"context"
+	"errors"
+	goflag "flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	flag "github.com/spf13/pflag"
+)
+
+// Exit codes
+const (
+	exitOK        = 0
+	exitFailure   = 1 // the command failed
+	exitUsage     = 2 // bad flags or arguments
+	exitFetchFail = 3 // some feeds could not be fetched
+)
+
+// exitError is an error that ends the program with a specific exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// usagef returns an error for bad arguments, which exits with exitUsage
+func usagef(format string, args ...any) error {
+	return &exitError{exitUsage, fmt.Errorf(format, args...)}
+}
+
+// exitCode returns the exit code for err
+func exitCode(err error) int {
+	var ee *exitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ee):
+		return ee.code
+	}
+	return exitFailure
+}
+
+// cli holds what the commands share: the configuration from the flags
+// and the store, which is opened once the flags are parsed
+type cli struct {
+	cfg   Config
+	store *FeedStore
+}
+
+// storeCommand adapts a command to ffcli
+func (c *cli) storeCommand(cmd command) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		return cmd(&c.cfg, c.store, args)
+	}
+}
+
+// newRootCommand builds the command tree. Listing flags given before a
+// subcommand still apply to it, so "rss -n 20 list" works like
+// "rss list -n 20".
+func (c *cli) newRootCommand() *ffcli.Command {
+	cfg := &c.cfg
+
+	rootFlags := flag.NewFlagSet("rss", flag.ContinueOnError)
+	registerGlobalFlags(rootFlags, cfg)
+	registerListFlags(rootFlags, cfg)
+	rootFlags.IntVarP(&cfg.Limit, "limit", "n", 100, "Maximum items to show")
+	registerLegacyFlags(rootFlags, cfg)
+
+	listFlags := flag.NewFlagSet("list", flag.ContinueOnError)
+	registerListFlags(listFlags, cfg)
+	listFlags.IntVarP(&cfg.Limit, "limit", "n", 100, "Maximum items to show")
+
+	// Exports hold every matching item unless -n says otherwise, so the
+	// limit is kept apart from the one shared with list
+	var exportLimit int
+	exportFlags := flag.NewFlagSet("export", flag.ContinueOnError)
+	registerListFlags(exportFlags, cfg)
+	exportFlags.IntVarP(&exportLimit, "limit", "n", 0, "Maximum items to export (0 all)")
+
+	fetchTimeout := 60 * time.Second
+	fetchFlags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	fetchFlags.DurationVar(&fetchTimeout, "timeout", fetchTimeout, "Give up on feeds still loading after this long")
+
+	purgeAge := defaultPurgeAge
+	purgeFlags := flag.NewFlagSet("purge", flag.ContinueOnError)
+	purgeFlags.StringVar(&purgeAge, "older-than", purgeAge, "Purge items published before this date expression ("+timeExprHelp+")")
+
+	var serve serveOptions
+	serveFlags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	serve.register(serveFlags)
+
+	root := &ffcli.Command{
+		Name:       "rss",
+		ShortUsage: "rss [global flags] <subcommand> [flags] [args...]",
+		LongHelp: strings.TrimSpace(`
+Without a subcommand rss lists stored items as earlier versions did: -u
+fetches every subscription first and -f with a URL fetches that feed.
+
+Exit codes: 0 success, 1 failure, 2 bad flags or arguments, 3 some feeds
+could not be fetched.`),
+		FlagSet: goFlagSet("rss", rootFlags),
+		Options: []ff.Option{
+			ff.WithEnvVarPrefix("RSS"),
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
+		},
+		Subcommands: []*ffcli.Command{
+			{
+				Name:       "fetch",
+				ShortUsage: "rss fetch [--timeout 60s] [<url> ...]",
+				ShortHelp:  "Fetch subscriptions or the given feeds",
+				LongHelp:   "Fetches every enabled subscription, or only the given feed URLs,\nsubscribing to new ones. Nothing is listed.",
+				FlagSet:    goFlagSet("fetch", fetchFlags),
+				Exec: func(ctx context.Context, args []string) error {
+					ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+					defer cancel()
+					return fetchFeeds(ctx, cfg, c.store, args)
+				},
+			},
+			{
+				Name:       "list",
+				ShortUsage: "rss list [flags]",
+				ShortHelp:  "List stored items without fetching",
+				FlagSet:    goFlagSet("list", listFlags),
+				Exec: func(ctx context.Context, args []string) error {
+					if len(args) > 0 {
+						return usagef("list takes no arguments")
+					}
+					return listItems(cfg, c.store, true)
+				},
+			},
+			{
+				Name:       "feeds",
+				ShortUsage: "rss feeds [health [<url>] | enable <url> | fulltext <url> [on|off]]",
+				ShortHelp:  "List subscriptions and manage their state",
+				FlagSet:    noFlags("feeds"),
+				Exec:       c.storeCommand(cmdFeeds),
+			},
+			{
+				Name:       "purge",
+				ShortUsage: "rss purge [--older-than 30d]",
+				ShortHelp:  "Remove old unstarred items",
+				FlagSet:    goFlagSet("purge", purgeFlags),
+				Exec: func(ctx context.Context, args []string) error {
+					if len(args) > 0 {
+						return usagef("purge takes no arguments")
+					}
+					before, err := parseTimeExpr(purgeAge, time.Now())
+					if err != nil {
+						return usagef("--older-than: %v", err)
+					}
+					return purgeItems(c.store, before.From)
+				},
+			},
+			{
+				Name:       "serve",
+				ShortUsage: "rss serve [--addr 127.0.0.1:8080] [--watch 15m] [--token <token>]",
+				ShortHelp:  "Serve aggregate feeds and the JSON API",
+				FlagSet:    goFlagSet("serve", serveFlags),
+				Exec: func(ctx context.Context, args []string) error {
+					if len(args) > 0 {
+						return usagef("serve takes no arguments")
+					}
+					return runServer(cfg, c.store, serve)
+				},
+			},
+			{
+				Name:       "export",
+				ShortUsage: "rss export -o <format> | --output-file <path> [flags]",
+				ShortHelp:  "Write stored items in an export format",
+				LongHelp:   "Formats: " + strings.Join(exporterNames(), ", ") + ". Unlike list, an export\nis not remembered for rss open and rss cat.",
+				FlagSet:    goFlagSet("export", exportFlags),
+				Exec: func(ctx context.Context, args []string) error {
+					if len(args) > 0 {
+						return usagef("export takes no arguments")
+					}
+					if cfg.Output == "" && cfg.OutputFile == "" {
+						return usagef("export needs -o or --output-file")
+					}
+					cfg.Limit = exportLimit
+					return listItems(cfg, c.store, false)
+				},
+			},
+		},
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return usagef("unknown command %q", args[0])
+			}
+			return legacyFetchAndList(ctx, cfg, c.store)
+		},
+	}
+	root.Subcommands = append(root.Subcommands, c.storeCommands()...)
+	return root
+}
+
+// registerGlobalFlags adds the flags that apply to every command
+func registerGlobalFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.DataDir, "data-dir", "", "Data directory")
+	fs.String("config", "", "Config file (one 'flag value' pair per line)")
+	fs.IntVarP(&cfg.MaxPerFeed, "max", "m", 100, "Maximum items to store per feed")
+	fs.BoolVar(&cfg.NoCache, "no-cache", false, "Fetch feeds in full instead of asking only for changes (ETag, Last-Modified)")
+	fs.StringVar(&cfg.UserAgent, "user-agent", defaultUserAgent, "User-Agent header sent with requests")
+	fs.StringVar(&cfg.Proxy, "proxy", "", "Proxy URL, or 'none' (default: HTTPS_PROXY/HTTP_PROXY/NO_PROXY)")
+	fs.StringSliceVar(&cfg.CACerts, "ca-cert", []string{}, "Extra PEM CA certificate files to trust")
+	fs.StringVar(&cfg.ClientCert, "client-cert", "", "PEM client certificate for TLS client auth")
+	fs.StringVar(&cfg.ClientKey, "client-key", "", "PEM private key for --client-cert")
+	fs.BoolVar(&cfg.InsecureSkipVerify, "insecure-skip-verify", false, "Do not verify TLS certificates (unsafe)")
+	fs.IntVar(&cfg.DisableAfterDays, "disable-after", int(defaultDisableAfter/(24*time.Hour)), "Days of consecutive fetch failures after which a feed is disabled (0 never)")
+	fs.IntVar(&cfg.RedirectThreshold, "redirect-threshold", defaultRedirectThreshold, "Consecutive permanent redirects before a subscription URL is rewritten")
+}
+
+// registerListFlags adds the flags that select, order and format a
+// listing; callers add --limit, whose default differs
+func registerListFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringArrayVarP(&cfg.Feeds, "feed", "f", []string{}, "Select feeds by title or URL: text, glob or /regex/ (repeatable)")
+	fs.StringArrayVar(&cfg.ExcludeFeeds, "exclude-feed", []string{}, "Leave out feeds whose title or URL matches (text, glob or /regex/)")
+	fs.StringArrayVar(&cfg.Categories, "category", []string{}, "Only items with a matching category (name, glob or /regex/)")
+	fs.StringArrayVar(&cfg.ExcludeCategories, "exclude-category", []string{}, "Leave out items with a matching category")
+	fs.BoolVar(&cfg.Group, "group", false, "Group the listing by feed")
+	fs.StringVarP(&cfg.Output, "output", "o", "", "Output format: "+strings.Join(exporterNames(), ", ")+" (default table, or from the --output-file extension)")
+	fs.StringVar(&cfg.OutputFile, "output-file", "", "Write the listing to this file instead of stdout")
+	fs.StringVarP(&cfg.Since, "since", "s", "", "Show items published since, or within a range ("+timeExprHelp+")")
+	fs.StringVar(&cfg.Until, "until", "", "Show items published up to the end of this date expression")
+	fs.StringVar(&cfg.Format, "format", "", "Custom format string")
+	fs.BoolVarP(&cfg.Reverse, "reverse", "r", false, "Reverse order (newest first)")
+	fs.StringVar(&cfg.Sort, "sort", "", "Sort by "+strings.Join(sortKeys, ", ")+" (default published)")
+	fs.IntVar(&cfg.Offset, "offset", 0, "Skip this many items, counted from the newest unless --oldest")
+	fs.StringVar(&cfg.Cursor, "cursor", "", "Continue a listing from the cursor printed with the previous page")
+	fs.BoolVar(&cfg.Oldest, "oldest", false, "Show the oldest --limit items instead of the newest")
+	fs.StringSliceVarP(&cfg.Tags, "tag", "t", []string{}, "Only show items with these tags")
+	fs.StringVar(&cfg.Filter, "filter", "", "Only show items whose title, feed or author contains this text")
+	fs.BoolVar(&cfg.Unread, "unread", false, "Only show unread items")
+	fs.BoolVar(&cfg.Duplicates, "duplicates", false, "Show every copy of a story found in several feeds")
+}
+
+// registerLegacyFlags adds the root command's fetch and purge switches;
+// the fetch and purge subcommands replace them
+func registerLegacyFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.BoolVarP(&cfg.Update, "update", "u", false, "Fetch every subscription before listing (see rss fetch)")
+	fs.BoolVar(&cfg.Purge, "purge", false, "Purge old items before listing (see rss purge)")
+	fs.StringVar(&cfg.PurgeAge, "purge-older-than", "", "Purge items published before this date expression, e.g. 30d (default 30d with --purge)")
+	if f := fs.Lookup("feed"); f != nil {
+		f.Usage = "Fetch this feed URL, or select feeds by title or URL: text, glob or /regex/ (repeatable)"
+	}
+}
+
+// goFlagSet mirrors a pflag set onto a standard library flag set, which is
+// what ff.Parse and ffcli expect. Shorthands are registered as aliases
+// sharing the same flag.Value, so -f and --feed both append to the same
+// slice.
+func goFlagSet(name string, fs *flag.FlagSet) *goflag.FlagSet {
+	gfs := goflag.NewFlagSet(name, goflag.ContinueOnError)
+	fs.VisitAll(func(f *flag.Flag) {
+		gfs.Var(f.Value, f.Name, f.Usage)
+		if f.Shorthand != "" {
+			gfs.Var(f.Value, f.Shorthand, "Shorthand for --"+f.Name)
+		}
+	})
+	return gfs
+}
+
+// noFlags returns an empty flag set for a command that takes only
+// arguments. Without one ffcli would make a flag set that exits on errors
+// instead of returning them, and -h would not print the command's usage.
+func noFlags(name string) *goflag.FlagSet {
+	return goflag.NewFlagSet(name, goflag.ContinueOnError)
+}
+
+// run parses args, opens the store and runs the selected command,
+// returning the exit code
+func run(args []string) int {
+	var c cli
+	root := c.newRootCommand()
+	if err := root.Parse(args); err != nil {
+		if errors.Is(err, goflag.ErrHelp) {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+
+	if c.cfg.DataDir == "" {
+		dir, err := getDataDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitFailure
+		}
+		c.cfg.DataDir = dir
+	} else if err := os.MkdirAll(c.cfg.DataDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFailure
+	}
+
+	storePath := filepath.Join(c.cfg.DataDir, "feeds.json")
+	store, err := NewFeedStore(storePath, c.cfg.MaxPerFeed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create store: %v\n", err)
+		return exitFailure
+	}
+	rules, err := LoadRules(c.cfg.DataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load rules: %v\n", err)
+		return exitFailure
+	}
+	store.SetRules(rules)
+	c.store = store
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = root.Run(ctx)
+	if err != nil && !errors.Is(err, goflag.ErrHelp) {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", redact(err.Error()))
+	}
+	return exitCode(err)
+}
+
+// fetchFeeds fetches urls, or every subscription when there are none, and
+// prints what was new. Failed feeds make the error an exitFetchFail.
+func fetchFeeds(ctx context.Context, cfg *Config, store *FeedStore, urls []string) error {
+	for _, u := range urls {
+		if !isFeedURL(u) {
+			return usagef("not a feed URL: %s", u)
+		}
+	}
+	fetcher, err := newConfiguredFetcher(cfg, store)
+	if err != nil {
+		return fmt.Errorf("setting up fetcher: %w", err)
+	}
+
+	// Explicit URLs are mapped to their current address if the feed has
+	// moved
+	if len(urls) == 0 {
+		urls = store.Subscriptions()
+	}
+	resolved := make([]string, len(urls))
+	for i, u := range urls {
+		resolved[i] = store.ResolveURL(u)
+	}
+
+	err = fetcher.FetchAll(ctx, resolved)
+	fetcher.PrintStats()
+	if err != nil {
+		return &exitError{exitFetchFail, err}
+	}
+	return nil
+}
+
+// purgeItems removes unstarred items published before cutoff
+func purgeItems(store *FeedStore, cutoff time.Time) error {
+	n, err := store.Purge(cutoff)
+	if err != nil {
+		return fmt.Errorf("purging items: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Purged %d items published before %s\n", n, cutoff.Format("2006-01-02 15:04"))
+	return nil
+}
+
+// listItems prints the stored items selected by cfg. With remember set the
+// listing is saved for rss open and rss cat.
+func listItems(cfg *Config, store *FeedStore, remember bool) error {
+	window, err := parseSinceUntil(cfg.Since, cfg.Until, time.Now())
+	if err == nil {
+		err = checkSortKey(cfg.Sort)
+	}
+	if err != nil {
+		return usagef("%v", err)
+	}
+	selection, err := cfg.selection()
+	if err != nil {
+		return usagef("%v", err)
+	}
+
+	selection.Since, selection.Until = window.From, window.Until
+	selection.Tags = cfg.Tags
+	selection.Query = cfg.Filter
+	selection.Unread = cfg.Unread
+	page := store.Page(cfg.listOptions(selection))
+	items := page.Items
+	if page.Next != "" {
+		fmt.Fprintf(os.Stderr, "Showing %d of %d items; for more use --cursor %q\n", len(items), page.Total, page.Next)
+	}
+
+	showFeed := spansFeeds(items)
+	if remember {
+		return outputItems(cfg, items, showFeed)
+	}
+	if cfg.Group {
+		items = groupItemsByFeed(items)
+		showFeed = true
+	}
+	return exportItems(cfg.Output, cfg.OutputFile, items, showFeed)
+}
+
+// legacyFetchAndList is what rss does without a subcommand: fetch when -u
+// or a --feed URL asks for it, purge with --purge, then list. Fetch
+// failures are reported but, as before, do not fail the listing.
+func legacyFetchAndList(ctx context.Context, cfg *Config, store *FeedStore) error {
+	// Check the listing options before fetching anything
+	if _, err := parseSinceUntil(cfg.Since, cfg.Until, time.Now()); err != nil {
+		return usagef("%v", err)
+	}
+	if err := checkSortKey(cfg.Sort); err != nil {
+		return usagef("%v", err)
+	}
+
+	var fetchURLs []string
+	for _, f := range cfg.Feeds {
+		if isFeedURL(f) {
+			fetchURLs = append(fetchURLs, f)
+		}
+	}
+	if cfg.Update || len(fetchURLs) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+		defer cancel()
+		// Failed feeds are reported, but what was stored is still listed
+		switch err := fetchFeeds(ctx, cfg, store, fetchURLs); {
+		case err == nil:
+		case exitCode(err) == exitFetchFail:
+			fmt.Fprintf(os.Stderr, "Failed to fetch feeds: %s\n", redact(err.Error()))
+		default:
+			return err
+		}
+	}
+
+	if cfg.Purge || cfg.PurgeAge != "" {
+		olderThan := cfg.PurgeAge
+		if olderThan == "" {
+			olderThan = defaultPurgeAge
+		}
+		before, err := parseTimeExpr(olderThan, time.Now())
+		if err != nil {
+			return usagef("--purge-older-than: %v", err)
+		}
+		if err := purgeItems(store, before.From); err != nil {
+			return err
+		}
+	}
+
+	return listItems(cfg, store, true)
+}
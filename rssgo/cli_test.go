@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// quietRun is run with stdout and stderr discarded
+func quietRun(t *testing.T, args ...string) int {
+	t.Helper()
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = null, null
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	return run(append([]string{"--data-dir", t.TempDir()}, args...))
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{errors.New("boom"), exitFailure},
+		{usagef("bad %s", "flag"), exitUsage},
+		{&exitError{exitFetchFail, errors.New("feeds failed")}, exitFetchFail},
+		{errors.Join(errors.New("other"), usagef("bad")), exitUsage},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := [][]string{
+		{"bogus"},
+		{"--no-such-flag"},
+		{"list", "extra"},
+		{"stats", "extra"},
+		{"rules", "test"},
+		{"open"},
+		{"cat", "1", "2"},
+		{"notify", "test"},
+		{"view", "save"},
+		{"digest", "--smtp", "mail.test:25"},
+		{"digest", "--since", "yesterdayish"},
+		{"download", "--max-size", "lots"},
+		{"purge", "--older-than", "soon"},
+		{"download", "--no-such-flag"},
+	}
+	for _, args := range tests {
+		if got := quietRun(t, args...); got != exitUsage {
+			t.Errorf("run(%q) = %d, want %d", args, got, exitUsage)
+		}
+	}
+}
+
+func TestRunHelp(t *testing.T) {
+	var c cli
+	for _, cmd := range c.newRootCommand().Subcommands {
+		if cmd.FlagSet == nil || cmd.ShortUsage == "" {
+			t.Errorf("%s: needs a flag set and a short usage", cmd.Name)
+			continue
+		}
+		if got := quietRun(t, cmd.Name, "-h"); got != exitOK {
+			t.Errorf("rss %s -h = %d, want %d", cmd.Name, got, exitOK)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// commands.go implements the stats and rules subcommands, and lists the
+// subcommands that work on stored items
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	flag "github.com/spf13/pflag"
+)
+
+// command runs a subcommand with its remaining positional arguments
+type command func(cfg *Config, store *FeedStore, args []string) error
+
+// storeCommands returns the subcommands that read or change stored items
+// and the files in the data directory. Those without flags still get a
+// flag set of their own (see noFlags).
+func (c *cli) storeCommands() []*ffcli.Command {
+	var digest digestOptions
+	digestFlags := flag.NewFlagSet("digest", flag.ContinueOnError)
+	digest.register(digestFlags)
+
+	tuiWatch := defaultTUIWatch
+	tuiFlags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	tuiFlags.DurationVar(&tuiWatch, "watch", tuiWatch, "Refresh all subscriptions in the background at this interval (0 disables)")
+
+	var download downloadOptions
+	downloadFlags := flag.NewFlagSet("download", flag.ContinueOnError)
+	download.register(downloadFlags)
+
+	return []*ffcli.Command{
+		{
+			Name:       "stats",
+			ShortUsage: "rss stats",
+			ShortHelp:  "Show the bandwidth each feed uses",
+			FlagSet:    noFlags("stats"),
+			Exec:       c.storeCommand(cmdStats),
+		},
+		{
+			Name:       "rules",
+			ShortUsage: "rss rules [list | test <feed-url>]",
+			ShortHelp:  "List the rules or try them on a feed",
+			FlagSet:    noFlags("rules"),
+			Exec:       c.storeCommand(cmdRules),
+		},
+		{
+			Name:       "tag",
+			ShortUsage: "rss tag [<id> [tag,-tag...]]",
+			ShortHelp:  "List tags, or show or edit an item's tags",
+			FlagSet:    noFlags("tag"),
+			Exec:       c.storeCommand(cmdTag),
+		},
+		{
+			Name:       "view",
+			ShortUsage: "rss view [<name> | save <name> [key=value...] | delete <name>]",
+			ShortHelp:  "Run and manage saved searches",
+			FlagSet:    noFlags("view"),
+			Exec:       c.storeCommand(cmdView),
+		},
+		{
+			Name:       "tui",
+			ShortUsage: "rss tui [--watch 15m]",
+			ShortHelp:  "Browse feeds and items interactively",
+			FlagSet:    goFlagSet("tui", tuiFlags),
+			Exec: func(ctx context.Context, args []string) error {
+				return cmdTUI(&c.cfg, c.store, tuiWatch, args)
+			},
+		},
+		{
+			Name:       "open",
+			ShortUsage: "rss open <index|id>",
+			ShortHelp:  "Open an item's link in the browser and mark it read",
+			FlagSet:    noFlags("open"),
+			Exec:       c.storeCommand(cmdOpen),
+		},
+		{
+			Name:       "cat",
+			ShortUsage: "rss cat <index|id>",
+			ShortHelp:  "Show an item's content through $PAGER",
+			FlagSet:    noFlags("cat"),
+			Exec:       c.storeCommand(cmdCat),
+		},
+		{
+			Name:       "notify",
+			ShortUsage: "rss notify [test <name>]",
+			ShortHelp:  "List notification targets or send one a test",
+			FlagSet:    noFlags("notify"),
+			Exec:       c.storeCommand(cmdNotify),
+		},
+		{
+			Name:       "digest",
+			ShortUsage: "rss digest [--since 24h] [--to <file> | --smtp <host:port> --rcpt <addr>] [flags]",
+			ShortHelp:  "Write or mail a digest of new unread items",
+			FlagSet:    goFlagSet("digest", digestFlags),
+			Exec: func(ctx context.Context, args []string) error {
+				if len(args) > 0 {
+					return usagef("digest takes no arguments")
+				}
+				return cmdDigest(&c.cfg, c.store, digest)
+			},
+		},
+		{
+			Name:       "download",
+			ShortUsage: "rss download [flags] [<index|id> ...]",
+			ShortHelp:  "Download the enclosures of items",
+			FlagSet:    goFlagSet("download", downloadFlags),
+			Exec: func(ctx context.Context, args []string) error {
+				return cmdDownload(&c.cfg, c.store, download, args)
+			},
+		},
+	}
+}
+
+// cmdStats prints per-feed bandwidth usage, most expensive first
+func cmdStats(cfg *Config, store *FeedStore, args []string) error {
+	if len(args) > 0 {
+		return usagef("stats takes no arguments")
+	}
+	metas := store.Meta()
+	if len(metas) == 0 {
+		fmt.Println("No feeds fetched yet")
+		return nil
+	}
+
+	sort.SliceStable(metas, func(i, j int) bool {
+		return metas[i].TotalCompressed > metas[j].TotalCompressed
+	})
+
+	var wire, decoded int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FEED\tFETCHES\tENCODING\tLAST\tTOTAL (WIRE)\tTOTAL (DECODED)\tSAVED")
+	for _, m := range metas {
+		name := m.Title
+		if name == "" {
+			name = m.URL
+		}
+		enc := m.Encoding
+		if enc == "" {
+			enc = "identity"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			redact(name),
+			m.Fetches,
+			enc,
+			formatBytes(m.BytesCompressed),
+			formatBytes(m.TotalCompressed),
+			formatBytes(m.TotalUncompressed),
+			savedPercent(m.TotalCompressed, m.TotalUncompressed),
+		)
+		wire += m.TotalCompressed
+		decoded += m.TotalUncompressed
+	}
+	fmt.Fprintf(w, "TOTAL\t\t\t\t%s\t%s\t%s\n",
+		formatBytes(wire), formatBytes(decoded), savedPercent(wire, decoded))
+
+	return w.Flush()
+}
+
+// savedPercent reports how much compression saved as a percentage
+func savedPercent(compressed, uncompressed int64) string {
+	if uncompressed == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*(1-float64(compressed)/float64(uncompressed)))
+}
+
+// cmdRules lists the configured rules, or with "test <feed-url>" fetches
+// the feed without storing it and shows what the rules would do
+func cmdRules(cfg *Config, store *FeedStore, args []string) error {
+	rules, err := LoadRules(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0] == "list" {
+		if len(rules.Rules) == 0 {
+			fmt.Printf("No rules in %s\n", filepath.Join(cfg.DataDir, rulesFile))
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tACTION\tCONDITIONS")
+		for _, r := range rules.Rules {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Action, describeConditions(r))
+		}
+		return w.Flush()
+	}
+
+	if args[0] != "test" || len(args) != 2 {
+		return usagef("usage: rss rules [list | test <feed-url>]")
+	}
+
+	fetcher, err := newConfiguredFetcher(cfg, store)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Test against the whole feed: a conditional request would get 304
+	// and no items for a subscribed feed that has not changed
+	fetcher.noCache = true
+	res, err := fetcher.fetchFeed(ctx, store.ResolveURL(args[1]))
+	if err != nil {
+		return err
+	}
+	// Links are matched as ingest stores them, including for items that
+	// are stored already
+	for i := range res.Items {
+		res.Items[i].Link = fetcher.normalizeLink(ctx, res.Items[i].Link)
+	}
+
+	var dropped, changed int
+	for _, item := range res.Items {
+		before := item
+		result := rules.Apply(&item)
+
+		switch {
+		case result.Dropped:
+			dropped++
+			fmt.Printf("DROP  %s\n", before.Title)
+		case len(result.Matched) > 0:
+			changed++
+			fmt.Printf("KEEP  %s\n", item.Title)
+			if item.Title != before.Title {
+				fmt.Printf("      was: %s\n", before.Title)
+			}
+			if item.Read {
+				fmt.Println("      marked read")
+			}
+			if item.Starred {
+				fmt.Println("      starred")
+			}
+			if len(item.Tags) > 0 {
+				fmt.Printf("      tags: %s\n", strings.Join(item.Tags, ", "))
+			}
+		default:
+			fmt.Printf("      %s\n", item.Title)
+			continue
+		}
+		fmt.Printf("      rules: %s\n", strings.Join(result.Matched, ", "))
+	}
+
+	fmt.Printf("\n%d items: %d dropped, %d modified, %d untouched\n",
+		len(res.Items), dropped, changed, len(res.Items)-dropped-changed)
+	return nil
+}
+
+// describeConditions summarises a rule's conditions for display
+func describeConditions(r Rule) string {
+	var conds []string
+	add := func(name, value string) {
+		if value != "" {
+			conds = append(conds, fmt.Sprintf("%s=%q", name, value))
+		}
+	}
+	add("feed", r.Feed)
+	add("title", r.Title)
+	add("author", r.Author)
+	add("category", r.Category)
+	add("host", r.Host)
+	if len(conds) == 0 {
+		return "(all items)"
+	}
+	return strings.Join(conds, " ")
+}
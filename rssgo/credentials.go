@@ -0,0 +1,256 @@
+// credentials.go applies per-feed authentication and custom headers
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// credentialsFile is the name of the credentials file in the data directory.
+// It is kept apart from the ff config so secrets never end up in a file
+// people copy around or check in.
+const credentialsFile = "credentials.json"
+
+// FeedAuth holds the credentials and headers for feeds under Match: the
+// same scheme and host, and a path at or below Match's path. Secret
+// values may be written literally or as "env:NAME" to read them from the
+// environment at startup.
+type FeedAuth struct {
+	Match    string            `json:"match"`
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Bearer   string            `json:"bearer,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// Credentials is the parsed credentials file
+type Credentials struct {
+	Feeds []FeedAuth `json:"feeds"`
+}
+
+// LoadCredentials reads the credentials file from dir. A missing file is
+// not an error; a file readable by group or others is.
+func LoadCredentials(dir string) (*Credentials, error) {
+	path := filepath.Join(dir, credentialsFile)
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return &Credentials{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("%s has mode %04o, must not be accessible by group or others (chmod 600)",
+			path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range creds.Feeds {
+		if err := creds.Feeds[i].resolve(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	// Longest prefix first, so the most specific entry wins
+	sort.SliceStable(creds.Feeds, func(i, j int) bool {
+		return len(creds.Feeds[i].Match) > len(creds.Feeds[j].Match)
+	})
+
+	return &creds, nil
+}
+
+// resolve expands env: references and registers every secret for redaction
+func (a *FeedAuth) resolve() error {
+	if a.Match == "" {
+		return fmt.Errorf("credentials entry without match")
+	}
+	if u, err := url.Parse(a.Match); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s: match must be an absolute URL such as https://example.com/path", a.Match)
+	}
+
+	var err error
+	expand := func(v string) string {
+		if err != nil {
+			return v
+		}
+		if v, err = expandEnv(v); err != nil {
+			err = fmt.Errorf("%s: %w", a.Match, err)
+		}
+		return v
+	}
+
+	a.Password = expand(a.Password)
+	a.Bearer = expand(a.Bearer)
+	for k, v := range a.Cookies {
+		a.Cookies[k] = expand(v)
+	}
+	for k, v := range a.Headers {
+		a.Headers[k] = expand(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Header and cookie values may carry API keys, so they are treated
+	// as secrets too
+	registerSecret(a.Password)
+	registerSecret(a.Bearer)
+	for _, v := range a.Cookies {
+		registerSecret(v)
+	}
+	for _, v := range a.Headers {
+		registerSecret(v)
+	}
+	return nil
+}
+
+// expandEnv returns the value of the environment variable NAME for a value
+// of the form "env:NAME", and v itself otherwise
+func expandEnv(v string) (string, error) {
+	if !strings.HasPrefix(v, "env:") {
+		return v, nil
+	}
+	name := strings.TrimPrefix(v, "env:")
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return val, nil
+}
+
+// For returns the entry matching rawURL, if any
+func (c *Credentials) For(rawURL string) *FeedAuth {
+	if c == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	for i := range c.Feeds {
+		if c.Feeds[i].matches(u) {
+			return &c.Feeds[i]
+		}
+	}
+	return nil
+}
+
+// matches reports whether u is under the entry's Match URL. Hosts must be
+// equal, not merely share a prefix, so credentials for example.com never
+// reach example.com.evil.net; paths match at segment boundaries only.
+func (a *FeedAuth) matches(u *url.URL) bool {
+	m, err := url.Parse(a.Match)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(m.Scheme, u.Scheme) || !strings.EqualFold(m.Host, u.Host) {
+		return false
+	}
+	if m.RawQuery != "" && m.RawQuery != u.RawQuery {
+		return false
+	}
+	prefix := strings.TrimSuffix(m.EscapedPath(), "/")
+	path := u.EscapedPath()
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// apply sets the entry's headers, cookies and authorization on req
+func (a *FeedAuth) apply(req *http.Request) {
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+	for name, value := range a.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	switch {
+	case a.Bearer != "":
+		req.Header.Set("Authorization", "Bearer "+a.Bearer)
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+}
+
+// authTransport decorates requests with the credentials for their URL.
+// It runs for every hop of a redirect, so credentials only reach URLs
+// their entry matches.
+type authTransport struct {
+	base  http.RoundTripper
+	creds *Credentials
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	auth := t.creds.For(req.URL.String())
+	if auth == nil {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	auth.apply(req)
+	return t.base.RoundTrip(req)
+}
+
+// secrets holds every credential value loaded, for redaction
+var secrets struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+func registerSecret(v string) {
+	// Very short values would redact unrelated text
+	if len(v) < 4 {
+		return
+	}
+	secrets.mu.Lock()
+	secrets.values = append(secrets.values, v)
+	secrets.mu.Unlock()
+}
+
+// redact removes URL passwords and known secret values from s. Everything
+// written to the terminal or a report that may contain a URL or an error
+// goes through it.
+func redact(s string) string {
+	if strings.Contains(s, "@") {
+		s = redactUserinfo(s)
+	}
+
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	for _, v := range secrets.values {
+		s = strings.ReplaceAll(s, v, "[REDACTED]")
+	}
+	return s
+}
+
+// redactUserinfo masks the password of any URL embedded in s
+func redactUserinfo(s string) string {
+	fields := strings.Fields(s)
+	for _, f := range fields {
+		trimmed := strings.Trim(f, `"'():,`)
+		u, err := url.Parse(trimmed)
+		if err != nil || u.User == nil {
+			continue
+		}
+		if _, ok := u.User.Password(); ok {
+			s = strings.ReplaceAll(s, trimmed, u.Redacted())
+		}
+	}
+	return s
+}
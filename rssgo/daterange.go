@@ -0,0 +1,216 @@
+// daterange.go parses the date expressions accepted by --since, --until
+// and the commands that select items by time
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeRange selects times from From up to, but not including, Until. A
+// zero bound leaves that side open.
+type timeRange struct {
+	From  time.Time
+	Until time.Time
+}
+
+// Contains reports whether t lies within r
+func (r timeRange) Contains(t time.Time) bool {
+	if !r.From.IsZero() && t.Before(r.From) {
+		return false
+	}
+	if !r.Until.IsZero() && !t.Before(r.Until) {
+		return false
+	}
+	return true
+}
+
+// String describes r for messages
+func (r timeRange) String() string {
+	const layout = "2006-01-02 15:04"
+	switch {
+	case r.From.IsZero() && r.Until.IsZero():
+		return "all time"
+	case r.Until.IsZero():
+		return "since " + r.From.Format(layout)
+	case r.From.IsZero():
+		return "before " + r.Until.Format(layout)
+	}
+	return r.From.Format(layout) + " to " + r.Until.Format(layout)
+}
+
+// timeExprHelp lists the accepted forms, for flag help and errors
+const timeExprHelp = "7d, 2w, 36h, today, yesterday, last-monday, 2024-05-01, 2024-05-01..2024-05-07"
+
+// dateExprLayouts are the absolute forms of a date expression
+var dateExprLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+// parseTimeExpr parses a date expression into the period it names. Days
+// and dates name the whole day, so "yesterday" runs from midnight to
+// midnight; durations back from now and full timestamps name an instant,
+// with From equal to Until. Times are in now's location.
+//
+//	7d, 2w, 36h, 1w2d, 90m   that long before now
+//	now, today, yesterday
+//	last-monday, monday      the most recent Monday before today
+//	2024-05-01               a local date
+//	2024-05-01T10:00         a local time; RFC 3339 times are also accepted
+func parseTimeExpr(s string, now time.Time) (timeRange, error) {
+	s = strings.TrimSpace(s)
+	word := strings.ToLower(s)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	day := func(t time.Time) timeRange { return timeRange{t, t.AddDate(0, 0, 1)} }
+	instant := func(t time.Time) timeRange { return timeRange{t, t} }
+
+	switch word {
+	case "":
+		return timeRange{}, fmt.Errorf("empty date expression")
+	case "now":
+		return instant(now), nil
+	case "today":
+		return day(midnight), nil
+	case "yesterday":
+		return day(midnight.AddDate(0, 0, -1)), nil
+	}
+
+	if wd, ok := parseWeekday(strings.TrimPrefix(word, "last-")); ok {
+		back := int(midnight.Weekday()-wd+7) % 7
+		if back == 0 {
+			back = 7
+		}
+		return day(midnight.AddDate(0, 0, -back)), nil
+	}
+
+	if d, err := parseLongDuration(word); err == nil {
+		return instant(now.Add(-d)), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return instant(t), nil
+	}
+	for _, layout := range dateExprLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			if layout == "2006-01-02" {
+				return day(t), nil
+			}
+			return instant(t), nil
+		}
+	}
+	return timeRange{}, fmt.Errorf("invalid date expression %q (want e.g. %s)", s, timeExprHelp)
+}
+
+// parseTimeRange parses a date expression or a range of two joined by
+// "..", either side of which may be left empty. A single expression
+// selects everything from the start of the period it names onwards; a
+// range runs from the start of its first period to the end of its second.
+func parseTimeRange(s string, now time.Time) (timeRange, error) {
+	from, until, isRange := strings.Cut(s, "..")
+	if !isRange {
+		r, err := parseTimeExpr(s, now)
+		return timeRange{From: r.From}, err
+	}
+
+	var r timeRange
+	if strings.TrimSpace(from) != "" {
+		start, err := parseTimeExpr(from, now)
+		if err != nil {
+			return r, err
+		}
+		r.From = start.From
+	}
+	if strings.TrimSpace(until) != "" {
+		end, err := parseTimeExpr(until, now)
+		if err != nil {
+			return r, err
+		}
+		r.Until = end.Until
+	}
+	if !r.From.IsZero() && !r.Until.IsZero() && r.Until.Before(r.From) {
+		return r, fmt.Errorf("date range %q ends before it starts", s)
+	}
+	return r, nil
+}
+
+// parseSinceUntil combines a since and an until expression into one
+// range; until names the end of its period, so "until yesterday" stops at
+// midnight
+func parseSinceUntil(since, until string, now time.Time) (timeRange, error) {
+	var r timeRange
+	if since != "" {
+		var err error
+		if r, err = parseTimeRange(since, now); err != nil {
+			return r, fmt.Errorf("since: %w", err)
+		}
+	}
+	if until != "" {
+		end, err := parseTimeExpr(until, now)
+		if err != nil {
+			return r, fmt.Errorf("until: %w", err)
+		}
+		if r.Until.IsZero() || end.Until.Before(r.Until) {
+			r.Until = end.Until
+		}
+	}
+	return r, nil
+}
+
+// parseWeekday parses an English weekday name or its three-letter form
+func parseWeekday(s string) (time.Weekday, bool) {
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if s == name || s == name[:3] {
+			return wd, true
+		}
+	}
+	return 0, false
+}
+
+// parseLongDuration parses a Go duration that may also use d (days) and
+// w (weeks) units, e.g. 7d, 2w or 1w2d12h
+func parseLongDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && (rest[i] >= '0' && rest[i] <= '9' || rest[i] == '.') {
+			i++
+		}
+		j := i
+		for j < len(rest) && (rest[j] < '0' || rest[j] > '9') && rest[j] != '.' {
+			j++
+		}
+		if i == 0 || j == i {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		var unit time.Duration
+		switch rest[i:j] {
+		case "d":
+			unit = 24 * time.Hour
+		case "w":
+			unit = 7 * 24 * time.Hour
+		default:
+			d, err := time.ParseDuration(rest[:j])
+			if err != nil {
+				return 0, err
+			}
+			total += d
+			rest = rest[j:]
+			continue
+		}
+		n, err := strconv.ParseFloat(rest[:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += time.Duration(n * float64(unit))
+		rest = rest[j:]
+	}
+	return total, nil
+}
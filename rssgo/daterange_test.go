@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rangeNow is a Wednesday afternoon
+var rangeNow = time.Date(2024, 5, 8, 15, 30, 0, 0, time.UTC)
+
+// mayDay returns midnight at the start of day d of May 2024
+func mayDay(d int) time.Time {
+	return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseTimeExpr(t *testing.T) {
+	at := func(d, h, m int) time.Time { return time.Date(2024, 5, d, h, m, 0, 0, time.UTC) }
+	ago := func(d time.Duration) time.Time { return rangeNow.Add(-d) }
+	tests := []struct {
+		expr        string
+		from, until time.Time
+	}{
+		{"now", rangeNow, rangeNow},
+		{"today", mayDay(8), mayDay(9)},
+		{"Yesterday", mayDay(7), mayDay(8)},
+		{"last-monday", mayDay(6), mayDay(7)},
+		{"tue", mayDay(7), mayDay(8)},
+		{"wednesday", mayDay(1), mayDay(2)}, // never today
+		{"7d", ago(7 * 24 * time.Hour), ago(7 * 24 * time.Hour)},
+		{"36h", at(7, 3, 30), at(7, 3, 30)},
+		{"1w2d", ago(9 * 24 * time.Hour), ago(9 * 24 * time.Hour)},
+		{"2024-05-01", mayDay(1), mayDay(2)},
+		{"2024-05-01T10:00", at(1, 10, 0), at(1, 10, 0)},
+		{"2024-05-01 10:00", at(1, 10, 0), at(1, 10, 0)},
+		{"2024-05-01T10:00:00Z", at(1, 10, 0), at(1, 10, 0)},
+	}
+	for _, tt := range tests {
+		r, err := parseTimeExpr(tt.expr, rangeNow)
+		if err != nil {
+			t.Errorf("parseTimeExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		if !r.From.Equal(tt.from) || !r.Until.Equal(tt.until) {
+			t.Errorf("parseTimeExpr(%q) = %v .. %v, want %v .. %v", tt.expr, r.From, r.Until, tt.from, tt.until)
+		}
+	}
+
+	for _, expr := range []string{"", "  ", "soon", "last-funday", "7x", "2024-13-01", "d7"} {
+		if _, err := parseTimeExpr(expr, rangeNow); err == nil {
+			t.Errorf("parseTimeExpr(%q): no error", expr)
+		}
+	}
+}
+
+func TestParseLongDuration(t *testing.T) {
+	day := 24 * time.Hour
+	tests := map[string]time.Duration{
+		"90m":     90 * time.Minute,
+		"7d":      7 * day,
+		"2w":      14 * day,
+		"1w2d12h": 9*day + 12*time.Hour,
+		"1.5d":    36 * time.Hour,
+		"1h30m":   90 * time.Minute,
+	}
+	for s, want := range tests {
+		if got, err := parseLongDuration(s); err != nil || got != want {
+			t.Errorf("parseLongDuration(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"d", "7", "7y", "w2", "1..2d"} {
+		if _, err := parseLongDuration(s); err == nil {
+			t.Errorf("parseLongDuration(%q): no error", s)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		expr        string
+		from, until time.Time
+	}{
+		{"yesterday", mayDay(7), time.Time{}},
+		{"2024-05-01..2024-05-03", mayDay(1), mayDay(4)},
+		{"2024-05-01..", mayDay(1), time.Time{}},
+		{"..yesterday", time.Time{}, mayDay(8)},
+		{"monday..today", mayDay(6), mayDay(9)},
+	}
+	for _, tt := range tests {
+		r, err := parseTimeRange(tt.expr, rangeNow)
+		if err != nil {
+			t.Errorf("parseTimeRange(%q): %v", tt.expr, err)
+			continue
+		}
+		if !r.From.Equal(tt.from) || !r.Until.Equal(tt.until) {
+			t.Errorf("parseTimeRange(%q) = %s, want %v .. %v", tt.expr, r, tt.from, tt.until)
+		}
+	}
+	for _, expr := range []string{"2024-05-03..2024-05-01", "soon..", "..soon"} {
+		if _, err := parseTimeRange(expr, rangeNow); err == nil {
+			t.Errorf("parseTimeRange(%q): no error", expr)
+		}
+	}
+}
+
+func TestParseSinceUntil(t *testing.T) {
+	tests := []struct {
+		since, until string
+		from, end    time.Time
+	}{
+		{"", "", time.Time{}, time.Time{}},
+		{"2024-05-01", "", mayDay(1), time.Time{}},
+		{"", "yesterday", time.Time{}, mayDay(8)},
+		{"2024-05-01", "2024-05-03", mayDay(1), mayDay(4)},
+		// The earlier of the two ends wins
+		{"2024-05-01..2024-05-03", "today", mayDay(1), mayDay(4)},
+		{"2024-05-01..today", "2024-05-03", mayDay(1), mayDay(4)},
+	}
+	for _, tt := range tests {
+		r, err := parseSinceUntil(tt.since, tt.until, rangeNow)
+		if err != nil {
+			t.Errorf("since %q until %q: %v", tt.since, tt.until, err)
+			continue
+		}
+		if !r.From.Equal(tt.from) || !r.Until.Equal(tt.end) {
+			t.Errorf("since %q until %q = %s, want %v .. %v", tt.since, tt.until, r, tt.from, tt.end)
+		}
+	}
+	if _, err := parseSinceUntil("", "soon", rangeNow); err == nil {
+		t.Error("bad until: no error")
+	}
+}
+
+func TestTimeRangeContains(t *testing.T) {
+	r := timeRange{From: mayDay(1), Until: mayDay(2)}
+	tests := map[time.Time]bool{
+		mayDay(1):                     true,
+		mayDay(1).Add(23 * time.Hour): true,
+		mayDay(2):                     false,
+		mayDay(1).Add(-time.Second):   false,
+	}
+	for at, want := range tests {
+		if got := r.Contains(at); got != want {
+			t.Errorf("%s contains %v = %v, want %v", r, at, got, want)
+		}
+	}
+	if !(timeRange{}).Contains(rangeNow) {
+		t.Error("open range does not contain now")
+	}
+}
@@ -0,0 +1,293 @@
+// dates.go normalizes the many date spellings found in real-world feeds
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// warnOutput receives non-fatal warnings emitted while parsing feeds
+var warnOutput io.Writer = os.Stderr
+
+// dateLayouts are tried in order after a date string has been normalized.
+// Weekdays are stripped and zone abbreviations rewritten to numeric offsets
+// beforehand, so none of these layouts carry a weekday or a named zone.
+var dateLayouts = []string{
+	// RFC 822 / RFC 1123 family
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04 -0700",
+	"2 January 2006 15:04:05",
+	"2 Jan 2006",
+	"2 January 2006",
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 2006 15:04:05",
+	"Jan 2 2006",
+	"January 2 2006 15:04:05 -0700",
+	"January 2 2006",
+
+	// ISO 8601 / RFC 3339 family
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04-0700",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"20060102T150405Z0700",
+	"20060102T150405",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+}
+
+// zoneOffsets maps the zone abbreviations seen in feeds to their UTC offset
+// in minutes. Ambiguous abbreviations resolve the way RFC 822 does (CST is
+// US Central), or to their most common use in feeds.
+var zoneOffsets = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0, "WET": 0,
+	"EST": -5 * 60, "EDT": -4 * 60,
+	"CST": -6 * 60, "CDT": -5 * 60,
+	"MST": -7 * 60, "MDT": -6 * 60,
+	"PST": -8 * 60, "PDT": -7 * 60,
+	"AKST": -9 * 60, "AKDT": -8 * 60,
+	"HST": -10 * 60,
+	"AST": -4 * 60, "NST": -3*60 - 30,
+	"BST": 60, "IST": 5*60 + 30, "WEST": 60,
+	"CET": 60, "CEST": 2 * 60, "MET": 60, "MEST": 2 * 60,
+	"EET": 2 * 60, "EEST": 3 * 60, "MSK": 3 * 60,
+	"CCT": 8 * 60, "HKT": 8 * 60, "SGT": 8 * 60, "AWST": 8 * 60,
+	"JST": 9 * 60, "KST": 9 * 60,
+	"ACST": 9*60 + 30, "AEST": 10 * 60, "AEDT": 11 * 60,
+	"NZST": 12 * 60, "NZDT": 13 * 60,
+}
+
+// monthNames maps localized month names and abbreviations (lowercase,
+// without a trailing dot) to the English abbreviation Go layouts expect.
+var monthNames = map[string]string{
+	// English, French and German also abbreviate September as "Sept"
+	"sept": "Sep",
+	// German
+	"januar": "Jan", "jänner": "Jan", "jän": "Jan", "februar": "Feb",
+	"märz": "Mar", "mär": "Mar", "maerz": "Mar", "mai": "May",
+	"juni": "Jun", "juli": "Jul", "oktober": "Oct", "okt": "Oct",
+	"dezember": "Dec", "dez": "Dec",
+	// French
+	"janvier": "Jan", "janv": "Jan", "février": "Feb", "fevrier": "Feb",
+	"févr": "Feb", "fevr": "Feb", "mars": "Mar", "avril": "Apr", "avr": "Apr",
+	"juin": "Jun", "juillet": "Jul", "juil": "Jul", "août": "Aug",
+	"aout": "Aug", "septembre": "Sep", "octobre": "Oct", "novembre": "Nov",
+	"décembre": "Dec", "decembre": "Dec", "déc": "Dec",
+	// Spanish
+	"enero": "Jan", "ene": "Jan", "febrero": "Feb", "marzo": "Mar",
+	"abril": "Apr", "abr": "Apr", "mayo": "May", "junio": "Jun",
+	"julio": "Jul", "agosto": "Aug", "ago": "Aug", "septiembre": "Sep",
+	"setiembre": "Sep", "octubre": "Oct", "noviembre": "Nov",
+	"diciembre": "Dec", "dic": "Dec",
+	// Italian
+	"gennaio": "Jan", "gen": "Jan", "febbraio": "Feb", "aprile": "Apr",
+	"maggio": "May", "mag": "May", "giugno": "Jun", "giu": "Jun",
+	"luglio": "Jul", "lug": "Jul", "settembre": "Sep", "set": "Sep",
+	"ottobre": "Oct", "ott": "Oct", "dicembre": "Dec",
+	// Portuguese
+	"janeiro": "Jan", "fevereiro": "Feb", "fev": "Feb", "março": "Mar",
+	"maio": "May", "junho": "Jun", "julho": "Jul", "setembro": "Sep",
+	"outubro": "Oct", "out": "Oct", "novembro": "Nov", "dezembro": "Dec",
+	// Dutch
+	"januari": "Jan", "februari": "Feb", "maart": "Mar", "mrt": "Mar",
+	"mei": "May", "augustus": "Aug",
+}
+
+// parseDate parses a feed timestamp in any of the supported spellings
+func parseDate(s string) (time.Time, error) {
+	norm := normalizeDate(s)
+	if norm == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, norm); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown format: %s", s)
+}
+
+// normalizeDate rewrites s into a form the layouts in dateLayouts accept:
+// it drops weekdays, translates localized month names, replaces named
+// zones with numeric offsets and removes ordinal suffixes and commas.
+func normalizeDate(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+
+	raw := strings.Fields(s)
+	if len(raw) == 0 {
+		return ""
+	}
+
+	// Drop a leading weekday ("Mon,", "Tuesday", "Mi.,", "lun."). A word
+	// followed by a comma is always a weekday, which also settles "mar.,"
+	// (French mardi) versus "Mar" (March).
+	first := strings.TrimSuffix(strings.TrimSuffix(raw[0], ","), ".")
+	if isAlpha(first) && (strings.HasSuffix(raw[0], ",") || isWeekday(first)) {
+		raw = raw[1:]
+	}
+
+	var fields []string
+	for _, f := range strings.Fields(strings.ReplaceAll(strings.Join(raw, " "), ",", " ")) {
+		lower := strings.ToLower(strings.TrimSuffix(f, "."))
+		if dateFillers[lower] {
+			continue
+		}
+		if en, ok := monthNames[lower]; ok {
+			fields = append(fields, en)
+			continue
+		}
+		// "3rd", "21st", "1er", "5."
+		f = stripOrdinal(strings.TrimSuffix(f, "."))
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+
+	// Drop a "+0000 (UTC)"-style comment after a numeric offset
+	if n := len(fields); n > 2 && strings.HasPrefix(fields[n-1], "(") && isOffset(fields[n-2]) {
+		fields = fields[:n-1]
+	}
+
+	// Rewrite a trailing named zone, e.g. "EST" or "(PDT)"
+	if n := len(fields); n > 1 {
+		last := strings.Trim(fields[n-1], "()")
+		if off, ok := zoneOffsets[strings.ToUpper(last)]; ok {
+			fields[n-1] = formatOffset(off)
+		}
+	}
+
+	// "2006-01-02T15:04:05 PST" leaves the offset as a separate field
+	if len(fields) == 2 && strings.Contains(fields[0], "T") && isOffset(fields[1]) {
+		return fields[0] + fields[1]
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// dateFillers are connecting words in localized dates ("5 de marzo de 2024")
+var dateFillers = map[string]bool{
+	"de": true, "del": true, "à": true, "a": true, "um": true, "om": true,
+	"at": true, "of": true,
+}
+
+// isWeekday reports whether s is a weekday name in any supported language
+func isWeekday(s string) bool {
+	s = strings.ToLower(strings.TrimSuffix(s, "."))
+	if !isAlpha(s) {
+		return false
+	}
+	if _, ok := monthNames[s]; ok {
+		return false
+	}
+	// "Mar" is both an English month and a Romance weekday prefix
+	if _, err := time.Parse("Jan", s); err == nil {
+		return false
+	}
+	if _, err := time.Parse("January", s); err == nil {
+		return false
+	}
+	if _, ok := zoneOffsets[strings.ToUpper(s)]; ok {
+		return false
+	}
+	for _, prefix := range weekdayPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// weekdayPrefixes identify weekday names in English, German, French,
+// Spanish, Italian, Portuguese and Dutch
+var weekdayPrefixes = []string{
+	"mon", "tue", "wed", "thu", "fri", "sat", "sun",
+	"mo", "di", "mi", "do", "fr", "sa", "so",
+	"lun", "mar", "mer", "jeu", "ven", "sam", "dim",
+	"mié", "jue", "vie", "sáb", "dom",
+	"gio", "seg", "ter", "qua", "qui", "sex",
+	"maa", "din", "woe", "don", "vri", "zat", "zon", "zo", "wo", "vr", "za",
+}
+
+// stripOrdinal removes English and French ordinal suffixes from a day number
+func stripOrdinal(s string) string {
+	lower := strings.ToLower(s)
+	for _, suffix := range []string{"st", "nd", "rd", "th", "er"} {
+		if strings.HasSuffix(lower, suffix) {
+			digits := s[:len(s)-len(suffix)]
+			if digits != "" && isDigits(digits) {
+				return digits
+			}
+		}
+	}
+	return s
+}
+
+// formatOffset formats an offset in minutes as ±hhmm
+func formatOffset(minutes int) string {
+	sign := '+'
+	if minutes < 0 {
+		sign = '-'
+		minutes = -minutes
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, minutes/60, minutes%60)
+}
+
+func isOffset(s string) bool {
+	return len(s) == 5 && (s[0] == '+' || s[0] == '-') && isDigits(s[1:])
+}
+
+func isAlpha(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// warnBadDates reports items whose dates could not be parsed. It prints a
+// single line per feed fetch rather than one per item.
+func warnBadDates(feed string, raw []string) {
+	if len(raw) == 0 {
+		return
+	}
+	fmt.Fprintf(warnOutput, "warning: %s: %d item(s) with unparseable dates (e.g. %q), using first-seen time\n",
+		redact(feed), len(raw), raw[0])
+}
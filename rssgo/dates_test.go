@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // RFC 3339 in UTC
+	}{
+		{"Mon, 06 May 2024 08:00:00 GMT", "2024-05-06T08:00:00Z"},
+		{"Mon, 06 May 2024 08:00:00 +0200", "2024-05-06T06:00:00Z"},
+		{"Mon, 6 May 2024 08:00 -0700", "2024-05-06T15:00:00Z"},
+		{"06 May 24 08:00:00 +0000", "2024-05-06T08:00:00Z"},
+		{"Monday, 06 May 2024 08:00:00 EST", "2024-05-06T13:00:00Z"},
+		{"Mon, 06 May 2024 08:00:00 CEST", "2024-05-06T06:00:00Z"},
+		{"2024-05-06T08:00:00Z", "2024-05-06T08:00:00Z"},
+		{"2024-05-06T08:00:00.123+02:00", "2024-05-06T06:00:00.123Z"},
+		{"  2024-05-06T08:00:00Z\n", "2024-05-06T08:00:00Z"},
+		{"Mi., 01 Mai 2024 10:00:00 MEST", "2024-05-01T08:00:00Z"},
+		{"6th May 2024 08:00:00 +0000", "2024-05-06T08:00:00Z"},
+		{"Mon, 16 Sept 2024 08:00:00 GMT", "2024-09-16T08:00:00Z"},
+		{"16 sept. 2024 08:00 +0200", "2024-09-16T06:00:00Z"},
+	}
+	for _, tt := range tests {
+		got, err := parseDate(tt.in)
+		if err != nil {
+			t.Errorf("parseDate(%q): %v", tt.in, err)
+			continue
+		}
+		if s := got.UTC().Format(time.RFC3339Nano); s != tt.want {
+			t.Errorf("parseDate(%q) = %s, want %s", tt.in, s, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "   ", "sometime last week", "32 May 2024"} {
+		if got, err := parseDate(in); err == nil {
+			t.Errorf("parseDate(%q) = %v, want an error", in, got)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// dedupe.go groups items from different feeds that tell the same story
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// clusterWindow is how far apart two items may be published and still be
+// matched by title
+const clusterWindow = 72 * time.Hour
+
+// minTitleSimilarity is the Dice coefficient of title words above which
+// two items count as the same story
+const minTitleSimilarity = 0.8
+
+// titleStopWords are left out when comparing titles
+var titleStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "to": true, "in": true,
+	"on": true, "for": true, "and": true, "or": true, "is": true, "are": true,
+	"with": true, "at": true, "by": true, "from": true,
+}
+
+// isTrackingParam reports whether the query parameter name carries no
+// meaning for the linked page; amp marks the AMP version of a page
+func isTrackingParam(name string) bool {
+	return matchParam(defaultStripParams, name) || strings.EqualFold(name, "amp")
+}
+
+// canonicalLink reduces link to a key shared by its variants: scheme,
+// www. and m. prefixes, AMP versions, tracking parameters, fragments and
+// trailing slashes are dropped
+func canonicalLink(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return strings.TrimSpace(link)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	path := u.EscapedPath()
+
+	// Google's AMP cache: https://example-com.cdn.ampproject.org/c/s/example.com/path
+	if strings.HasSuffix(host, ".cdn.ampproject.org") {
+		rest := strings.TrimPrefix(strings.TrimPrefix(path, "/c/"), "/v/")
+		rest = strings.TrimPrefix(rest, "s/")
+		if h, p, ok := strings.Cut(rest, "/"); ok && h != "" {
+			host, path = strings.ToLower(h), "/"+p
+		}
+	}
+	for _, prefix := range []string{"www.", "amp.", "m."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	path = strings.TrimPrefix(path, "/amp/")
+	path = strings.TrimSuffix(path, "/")
+	path = strings.TrimSuffix(path, "/amp")
+	path = strings.TrimSuffix(path, ".amp")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	query := u.Query()
+	for name := range query {
+		if isTrackingParam(name) {
+			query.Del(name)
+		}
+	}
+	key := host + path
+	if len(query) > 0 {
+		key += "?" + query.Encode()
+	}
+	return key
+}
+
+// titleWords returns the distinct significant words of a title
+func titleWords(title string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !titleStopWords[w] {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// titleSimilarity returns the Dice coefficient of two word sets
+func titleSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	var common int
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b))
+}
+
+// sameTitle reports whether other, from another feed, has a title
+// closely matching the given title words and was published around the
+// same time as item
+func sameTitle(item *FeedItem, words map[string]bool, other *FeedItem) bool {
+	if item.Feed == other.Feed {
+		return false
+	}
+	gap := item.Published.Sub(other.Published)
+	if gap < -clusterWindow || gap > clusterWindow {
+		return false
+	}
+	return titleSimilarity(words, titleWords(other.Title)) >= minTitleSimilarity
+}
+
+// clusterIndex looks up stored items while Add assigns clusters, so the
+// stored links are parsed once per Add rather than once per new item
+type clusterIndex struct {
+	byLink map[string][]int // canonical link to indices into s.items
+	sorted int              // s.items[:sorted] is in published order
+}
+
+// newClusterIndex indexes the stored items; the caller must hold s.mu
+func (s *FeedStore) newClusterIndex() *clusterIndex {
+	idx := &clusterIndex{byLink: make(map[string][]int), sorted: len(s.items)}
+	for i, item := range s.items {
+		if item.Link != "" {
+			link := canonicalLink(item.Link)
+			idx.byLink[link] = append(idx.byLink[link], i)
+		}
+	}
+	return idx
+}
+
+// assignCluster puts item into the cluster of the first stored item from
+// another feed that tells the same story: one with the same canonical
+// link, or failing that one with a closely matching title published
+// within clusterWindow. A cluster is named after the ID of its first
+// item. item is recorded in idx as the next element of s.items. The
+// caller must hold s.mu.
+func (s *FeedStore) assignCluster(item *FeedItem, idx *clusterIndex) {
+	var link string
+	if item.Link != "" {
+		link = canonicalLink(item.Link)
+	}
+	match := -1
+	for _, i := range idx.byLink[link] {
+		if s.items[i].Feed != item.Feed {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		match = s.titleMatch(item, idx)
+	}
+	if match >= 0 {
+		other := &s.items[match]
+		if other.Cluster == "" {
+			other.Cluster = other.ID
+		}
+		item.Cluster = other.Cluster
+	}
+
+	if link != "" {
+		idx.byLink[link] = append(idx.byLink[link], len(s.items))
+	}
+}
+
+// titleMatch returns the index of the first stored item with the same
+// story by title, or -1. Only the sorted items published within
+// clusterWindow of item are compared, then those added since idx was made.
+func (s *FeedStore) titleMatch(item *FeedItem, idx *clusterIndex) int {
+	words := titleWords(item.Title)
+	if len(words) < 3 {
+		return -1
+	}
+	earliest := item.Published.Add(-clusterWindow)
+	latest := item.Published.Add(clusterWindow)
+	i := sort.Search(idx.sorted, func(i int) bool {
+		return !s.items[i].Published.Before(earliest)
+	})
+	for ; i < idx.sorted && !s.items[i].Published.After(latest); i++ {
+		if sameTitle(item, words, &s.items[i]) {
+			return i
+		}
+	}
+	for i := idx.sorted; i < len(s.items); i++ {
+		if sameTitle(item, words, &s.items[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// collapseClusters keeps the first item of each cluster in items and
+// notes in its AlsoIn the other feeds the story was stored from. The
+// caller must hold s.mu.
+func (s *FeedStore) collapseClusters(items []FeedItem) []FeedItem {
+	feeds := make(map[string][]string)
+	for _, item := range s.items {
+		if item.Cluster != "" && !contains(feeds[item.Cluster], item.Feed) {
+			feeds[item.Cluster] = append(feeds[item.Cluster], item.Feed)
+		}
+	}
+
+	seen := make(map[string]bool)
+	out := items[:0]
+	for _, item := range items {
+		if item.Cluster == "" {
+			out = append(out, item)
+			continue
+		}
+		if seen[item.Cluster] {
+			continue
+		}
+		seen[item.Cluster] = true
+		for _, feed := range feeds[item.Cluster] {
+			if feed != item.Feed {
+				item.AlsoIn = append(item.AlsoIn, feed)
+			}
+		}
+		out = append(out, item)
+	}
+	return out
+}
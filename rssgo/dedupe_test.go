@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanonicalLink(t *testing.T) {
+	tests := []struct {
+		link string
+		want string
+	}{
+		{"https://example.com/post/", "example.com/post"},
+		{"http://www.example.com/post#comments", "example.com/post"},
+		{"https://m.example.com/post?utm_source=rss&utm_medium=feed", "example.com/post"},
+		{"https://example.com/post/amp", "example.com/post"},
+		{"https://example.com/amp/post", "example.com/post"},
+		{"https://amp.example.com/post.amp", "example.com/post"},
+		{"https://example-com.cdn.ampproject.org/c/s/example.com/post", "example.com/post"},
+		{"https://Example.com:443/post?id=7&fbclid=x", "example.com/post?id=7"},
+		{"https://example.com:8443/post", "example.com:8443/post"},
+		{"https://example.com", "example.com/"},
+		{"  not a url  ", "not a url"},
+	}
+	for _, tt := range tests {
+		if got := canonicalLink(tt.link); got != tt.want {
+			t.Errorf("canonicalLink(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Go 1.22 is released", "Go 1.22 is released!", 1},
+		{"The Go 1.22 release", "Go 1.22 release", 1},
+		{"Go 1.22 released", "Rust 1.75 released", 0.5},
+		{"", "Go 1.22 released", 0},
+		{"a the of", "Go", 0},
+	}
+	for _, tt := range tests {
+		if got := titleSimilarity(titleWords(tt.a), titleWords(tt.b)); got != tt.want {
+			t.Errorf("titleSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestAddClustersSameStory(t *testing.T) {
+	store := newTestStore(t, 10)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	item := func(id, feed, title, link string, hours int) FeedItem {
+		return FeedItem{ID: id, Feed: feed, Title: title, Link: link, Published: base.Add(time.Duration(hours) * time.Hour)}
+	}
+
+	if _, err := store.Add([]FeedItem{
+		item("a1", "A", "Major outage hits cloud provider", "https://news.test/outage", 0),
+		item("a2", "A", "Unrelated story about gardening", "https://news.test/garden", 1),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	added, err := store.Add([]FeedItem{
+		item("b1", "B", "Something else entirely", "https://www.news.test/outage/?utm_source=b", 2),
+		item("b2", "B", "Unrelated story about gardening!", "https://b.test/garden", 5),
+		item("b3", "B", "Unrelated story about gardening", "https://b.test/garden-late", 100),
+		item("a3", "A", "Major outage hits cloud provider", "https://news.test/outage-again", 3),
+		item("c1", "C", "Short", "https://c.test/outage-again", 4),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"b1": "a1", // same canonical link
+		"b2": "a2", // same title within the window
+		"b3": "",   // same title, too late
+		"a3": "",   // same feed as a1
+		"c1": "",   // title too short, link unknown
+	}
+	for _, got := range added {
+		if got.Cluster != want[got.ID] {
+			t.Errorf("%s: cluster = %q, want %q", got.ID, got.Cluster, want[got.ID])
+		}
+	}
+}
+
+func TestAddClustersWithinOneBatch(t *testing.T) {
+	store := newTestStore(t, 10)
+	first := testItem("A", 1)
+	second := testItem("B", 2)
+	second.Link = first.Link + "?utm_campaign=x"
+
+	added, err := store.Add([]FeedItem{first, second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added[1].Cluster != first.ID {
+		t.Errorf("cluster = %q, want %q", added[1].Cluster, first.ID)
+	}
+}
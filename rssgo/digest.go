@@ -0,0 +1,303 @@
+// digest.go renders new unread items as a multipart email and sends it
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	flag "github.com/spf13/pflag"
+)
+
+// digestSummaryLength is how many characters of each item's content the
+// digest quotes
+const digestSummaryLength = 300
+
+// digestGroup is one feed's section of a digest
+type digestGroup struct {
+	Feed  string
+	Items []digestItem
+}
+
+// digestItem is an item as shown in a digest
+type digestItem struct {
+	FeedItem
+	Summary string
+}
+
+// digest is the data a digest email is rendered from
+type digest struct {
+	Subject string
+	Range   timeRange
+	Count   int
+	Groups  []digestGroup
+}
+
+// digestOptions are the flags of rss digest
+type digestOptions struct {
+	since    string
+	until    string
+	to       string
+	feed     string
+	subject  string
+	smtpAddr string
+	from     string
+	rcpts    []string
+	smtpUser string
+	markRead bool
+}
+
+// register adds the digest flags to fs
+func (o *digestOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.since, "since", "24h", "Include unread items added since, or within a range ("+timeExprHelp+")")
+	fs.StringVar(&o.until, "until", "", "Include unread items added up to the end of this date expression")
+	fs.StringVar(&o.to, "to", "", "Write the email to this .eml file instead of stdout (- for stdout)")
+	fs.StringVar(&o.feed, "feed", "", "Only include feeds whose title contains this")
+	fs.StringVar(&o.subject, "subject", "", "Subject line (default: RSS digest with the item count)")
+	fs.StringVar(&o.smtpAddr, "smtp", "", "Send through this SMTP server (host:port)")
+	fs.StringVar(&o.from, "from", "rss@localhost", "Sender address")
+	fs.StringSliceVar(&o.rcpts, "rcpt", nil, "Recipient address (repeatable)")
+	fs.StringVar(&o.smtpUser, "smtp-user", "", "SMTP username; the password is read from RSS_SMTP_PASSWORD")
+	fs.BoolVar(&o.markRead, "mark-read", false, "Mark the included items read once written or sent")
+}
+
+// cmdDigest writes or mails a digest of the unread items added recently
+func cmdDigest(cfg *Config, store *FeedStore, opts digestOptions) error {
+	if opts.smtpAddr != "" && len(opts.rcpts) == 0 {
+		return usagef("--smtp needs at least one --rcpt")
+	}
+
+	now := time.Now()
+	window, err := parseSinceUntil(opts.since, opts.until, now)
+	if err != nil {
+		return usagef("%v", err)
+	}
+	d := buildDigest(store.ListWith(ListOptions{Feed: opts.feed, Unread: true}), window)
+	if d.Count == 0 {
+		fmt.Fprintln(os.Stderr, "No new unread items")
+		return nil
+	}
+	d.Subject = opts.subject
+	if d.Subject == "" {
+		d.Subject = fmt.Sprintf("RSS digest: %d new items (%s)", d.Count, now.Format("2006-01-02"))
+	}
+
+	msg, err := renderDigest(d, opts.from, opts.rcpts, now)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.smtpAddr != "":
+		if err := sendMail(opts.smtpAddr, opts.smtpUser, opts.from, opts.rcpts, msg); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Sent digest of %d items to %s\n", d.Count, strings.Join(opts.rcpts, ", "))
+	case opts.to != "" && opts.to != "-":
+		if err := os.WriteFile(opts.to, msg, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote digest of %d items to %s\n", d.Count, opts.to)
+	default:
+		if _, err := os.Stdout.Write(msg); err != nil {
+			return err
+		}
+	}
+
+	if opts.markRead {
+		var ids []string
+		for _, g := range d.Groups {
+			for _, item := range g.Items {
+				ids = append(ids, item.ID)
+			}
+		}
+		return store.SetRead(ids, true)
+	}
+	return nil
+}
+
+// buildDigest groups the items added within window by feed, feeds in
+// alphabetical order and items oldest first
+func buildDigest(items []FeedItem, window timeRange) digest {
+	d := digest{Range: window}
+	groups := make(map[string]*digestGroup)
+	for _, item := range items {
+		if !window.Contains(item.Added) {
+			continue
+		}
+		g, ok := groups[item.Feed]
+		if !ok {
+			g = &digestGroup{Feed: item.Feed}
+			groups[item.Feed] = g
+		}
+		g.Items = append(g.Items, digestItem{
+			FeedItem: item,
+			Summary:  truncate(cleanText(item.Content), digestSummaryLength),
+		})
+		d.Count++
+	}
+
+	for _, g := range groups {
+		d.Groups = append(d.Groups, *g)
+	}
+	sort.Slice(d.Groups, func(i, j int) bool {
+		return d.Groups[i].Feed < d.Groups[j].Feed
+	})
+	return d
+}
+
+// renderDigest builds the complete RFC 5322 message with plain text and
+// HTML alternatives
+func renderDigest(d digest, from string, rcpts []string, now time.Time) ([]byte, error) {
+	var text, html bytes.Buffer
+	if err := digestText(&text, d); err != nil {
+		return nil, err
+	}
+	if err := digestHTML.Execute(&html, d); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	to := "undisclosed-recipients:;"
+	if len(rcpts) > 0 {
+		to = strings.Join(rcpts, ", ")
+	}
+
+	var msg bytes.Buffer
+	header := []struct{ key, value string }{
+		{"From", from},
+		{"To", to},
+		{"Subject", mime.QEncoding.Encode("utf-8", d.Subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", messageID(from)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `multipart/alternative; boundary="` + mw.Boundary() + `"`},
+	}
+	for _, h := range header {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h.key, h.value)
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// digestText writes the plain text alternative of d
+func digestText(w io.Writer, d digest) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new items %s\n", d.Count, d.Range)
+	for _, g := range d.Groups {
+		heading := fmt.Sprintf("%s (%d)", g.Feed, len(g.Items))
+		fmt.Fprintf(&b, "\n%s\n%s\n", heading, strings.Repeat("=", utf8.RuneCountInString(heading)))
+		for _, item := range g.Items {
+			fmt.Fprintf(&b, "\n* %s\n", item.Title)
+			fmt.Fprintf(&b, "  %s", item.Published.Format("2006-01-02 15:04"))
+			if item.Author != "" {
+				fmt.Fprintf(&b, " · %s", item.Author)
+			}
+			fmt.Fprintln(&b)
+			if item.Link != "" {
+				fmt.Fprintf(&b, "  %s\n", item.Link)
+			}
+			for _, line := range wrapText(item.Summary, 72) {
+				if line != "" {
+					fmt.Fprintf(&b, "  %s\n", line)
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var digestHTML = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em">
+<p>{{.Count}} new items {{.Range}}</p>
+{{range .Groups}}<h2>{{.Feed}} ({{len .Items}})</h2>
+{{range .Items}}<div style="margin-bottom: 1em">
+<div>{{if .Link}}<a href="{{.Link}}"><strong>{{.Title}}</strong></a>{{else}}<strong>{{.Title}}</strong>{{end}}</div>
+<div style="color: #666; font-size: smaller">{{.Published.Format "2006-01-02 15:04"}}{{with .Author}} · {{.}}{{end}}</div>
+{{with .Summary}}<div>{{.}}</div>{{end}}
+</div>
+{{end}}{{end}}</body></html>
+`))
+
+// messageID returns a unique Message-ID in the domain of from
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.Trim(from[i+1:], "> ")
+	}
+	var b [12]byte
+	rand.Read(b[:])
+	return "<" + hex.EncodeToString(b[:]) + "@" + domain + ">"
+}
+
+// sendMail delivers msg through the SMTP server at addr, using STARTTLS
+// when the server offers it. With user set, the password is taken from
+// RSS_SMTP_PASSWORD.
+func sendMail(addr, user, from string, rcpts []string, msg []byte) error {
+	var auth smtp.Auth
+	if user != "" {
+		password := os.Getenv("RSS_SMTP_PASSWORD")
+		registerSecret(password)
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %q: %w", addr, err)
+		}
+		auth = smtp.PlainAuth("", user, password, host)
+	}
+	if err := smtp.SendMail(addr, auth, from, rcpts, msg); err != nil {
+		return fmt.Errorf("sending digest: %w", err)
+	}
+	return nil
+}
+
+// truncate shortens s to at most n characters, ending in "…" if cut
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(string([]rune(s)[:n-1])) + "…"
+}
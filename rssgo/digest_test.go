@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a minimal SMTP server that accepts one message per
+// connection and records its envelope and data. Recipients in reject are
+// refused.
+type fakeSMTP struct {
+	net.Listener
+	reject string
+
+	mu    sync.Mutex
+	from  string
+	rcpts []string
+	data  string
+}
+
+func newFakeSMTP(t *testing.T, reject string) *fakeSMTP {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{Listener: l, reject: reject}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 fake.test ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250 fake.test")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if rcpt == s.reject {
+				reply("550 no such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, rcpt)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+// digestStore returns a store holding two unread items added just now
+func digestStore(t *testing.T) *FeedStore {
+	t.Helper()
+	store := newTestStore(t, 10)
+	var items []FeedItem
+	for i, feed := range []string{"Go Blog", "Rust Blog"} {
+		item := testItem(feed, i)
+		item.Added = time.Now()
+		items = append(items, item)
+	}
+	if _, err := store.Add(items); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// unreadCount returns the number of unread items in store
+func unreadCount(store *FeedStore) int {
+	return len(store.ListWith(ListOptions{Unread: true}))
+}
+
+func TestDigestSendsMail(t *testing.T) {
+	srv := newFakeSMTP(t, "")
+	store := digestStore(t)
+	cfg := &Config{DataDir: t.TempDir()}
+	opts := digestOptions{
+		since:    "24h",
+		smtpAddr: srv.Addr().String(),
+		from:     "rss@example.test",
+		rcpts:    []string{"me@example.test", "you@example.test"},
+		markRead: true,
+	}
+	if err := cmdDigest(cfg, store, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.from != opts.from {
+		t.Errorf("MAIL FROM = %q, want %q", srv.from, opts.from)
+	}
+	if strings.Join(srv.rcpts, ",") != "me@example.test,you@example.test" {
+		t.Errorf("RCPT TO = %q, want %q", srv.rcpts, opts.rcpts)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(srv.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("To"); got != "me@example.test, you@example.test" {
+		t.Errorf("To = %q", got)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", msg.Header.Get("Content-Type"), err)
+	}
+	var types []string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, title := range []string{"Go Blog at hour 0", "Rust Blog at hour 1"} {
+			if !strings.Contains(string(body), title) {
+				t.Errorf("%s part lacks %q", part.Header.Get("Content-Type"), title)
+			}
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	if strings.Join(types, ",") != "text/plain; charset=utf-8,text/html; charset=utf-8" {
+		t.Errorf("parts = %q, want text and HTML", types)
+	}
+
+	if n := unreadCount(store); n != 0 {
+		t.Errorf("%d items unread after sending, want 0", n)
+	}
+}
+
+func TestDigestKeepsItemsUnreadWhenSendingFails(t *testing.T) {
+	srv := newFakeSMTP(t, "you@example.test")
+	store := digestStore(t)
+	cfg := &Config{DataDir: t.TempDir()}
+	opts := digestOptions{
+		since:    "24h",
+		smtpAddr: srv.Addr().String(),
+		from:     "rss@example.test",
+		rcpts:    []string{"me@example.test", "you@example.test"},
+		markRead: true,
+	}
+	if err := cmdDigest(cfg, store, opts); err == nil {
+		t.Fatal("no error for a refused recipient")
+	}
+	if n := unreadCount(store); n != 2 {
+		t.Errorf("%d items unread after a failed send, want 2", n)
+	}
+}
@@ -0,0 +1,465 @@
+// download.go fetches podcast episodes and other item enclosures
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// downloadsFile records finished downloads in the data directory
+const downloadsFile = "downloads.json"
+
+// Enclosure is a media file attached to an item, such as a podcast episode
+type Enclosure struct {
+	URL      string        `json:"url"`
+	Type     string        `json:"type,omitempty"`
+	Length   int64         `json:"length,omitempty"`   // bytes, as declared by the feed
+	Duration time.Duration `json:"duration,omitempty"` // from itunes:duration
+}
+
+// DownloadRecord describes a finished enclosure download
+type DownloadRecord struct {
+	URL      string    `json:"url"`
+	ItemID   string    `json:"item_id"`
+	Feed     string    `json:"feed"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Finished time.Time `json:"finished"`
+}
+
+// errTooLarge is returned for enclosures over the size limit
+var errTooLarge = errors.New("exceeds the size limit")
+
+// parseItunesDuration parses itunes:duration, which is either a number of
+// seconds or [[HH:]MM:]SS
+func parseItunesDuration(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	var total float64
+	for _, part := range strings.Split(s, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0
+		}
+		total = total*60 + v
+	}
+	return time.Duration(total * float64(time.Second))
+}
+
+// parseSize parses a byte count with an optional K, M or G suffix
+// (powers of 1024, as formatBytes prints them)
+func parseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	mult := int64(1)
+	if n := len(v); n > 0 {
+		switch v[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		}
+		if mult > 1 {
+			v = strings.TrimSpace(v[:n-1])
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// downloader fetches enclosures into one directory per feed
+type downloader struct {
+	fetcher *Fetcher
+	client  *http.Client
+	dir     string
+	maxSize int64 // 0 for no limit
+
+	mu         sync.Mutex
+	records    map[string]DownloadRecord // by enclosure URL
+	recordPath string
+}
+
+// newDownloader returns a downloader writing below dir and recording its
+// downloads in dataDir
+func newDownloader(fetcher *Fetcher, dataDir, dir string, maxSize int64) (*downloader, error) {
+	d := &downloader{
+		fetcher:    fetcher,
+		dir:        dir,
+		maxSize:    maxSize,
+		records:    make(map[string]DownloadRecord),
+		recordPath: filepath.Join(dataDir, downloadsFile),
+	}
+
+	// Same transport and credentials as feed fetches, but no overall
+	// timeout: episodes can take a long time
+	client := *fetcher.client
+	client.Timeout = 0
+	d.client = &client
+
+	data, err := os.ReadFile(d.recordPath)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &d.records); err != nil {
+		return nil, fmt.Errorf("%s: %w", d.recordPath, err)
+	}
+	return d, nil
+}
+
+// done returns the record of a finished download of u whose file still
+// exists
+func (d *downloader) done(u string) (DownloadRecord, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rec, ok := d.records[u]
+	if !ok {
+		return rec, false
+	}
+	if _, err := os.Stat(rec.Path); err != nil {
+		return rec, false
+	}
+	return rec, true
+}
+
+// record stores rec and saves the download record file
+func (d *downloader) record(rec DownloadRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.records[rec.URL] = rec
+	data, err := json.MarshalIndent(d.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write atomically
+	tmpPath := d.recordPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, d.recordPath)
+}
+
+// download fetches e into the item's feed directory, resuming a partial
+// download left by an earlier run. It reports false if e was already
+// downloaded.
+func (d *downloader) download(ctx context.Context, item FeedItem, e Enclosure) (DownloadRecord, bool, error) {
+	if rec, ok := d.done(e.URL); ok {
+		return rec, false, nil
+	}
+	if d.maxSize > 0 && e.Length > d.maxSize {
+		return DownloadRecord{}, false, fmt.Errorf("declared size %s %w", formatBytes(e.Length), errTooLarge)
+	}
+
+	feedDir := filepath.Join(d.dir, safeFileName(item.Feed, "feed"))
+	if err := os.MkdirAll(feedDir, 0755); err != nil {
+		return DownloadRecord{}, false, err
+	}
+	final := filepath.Join(feedDir, enclosureFileName(e))
+	partial := final + ".part"
+
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.URL, nil)
+	if err != nil {
+		return DownloadRecord{}, false, err
+	}
+	req.Header.Set("User-Agent", d.fetcher.userAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return DownloadRecord{}, false, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && rangeStart(resp) == offset:
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file already holds everything
+		return d.finish(item, e, partial, final, offset)
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range: start over
+		offset = 0
+		flags |= os.O_TRUNC
+	default:
+		return DownloadRecord{}, false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	if d.maxSize > 0 && resp.ContentLength > 0 && offset+resp.ContentLength > d.maxSize {
+		return DownloadRecord{}, false, fmt.Errorf("size %s %w", formatBytes(offset+resp.ContentLength), errTooLarge)
+	}
+
+	f, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return DownloadRecord{}, false, err
+	}
+	body := io.Reader(resp.Body)
+	if d.maxSize > 0 {
+		body = io.LimitReader(resp.Body, d.maxSize-offset+1)
+	}
+	n, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// Keep the partial file so the next run can resume
+		return DownloadRecord{}, false, err
+	}
+	if d.maxSize > 0 && offset+n > d.maxSize {
+		os.Remove(partial)
+		return DownloadRecord{}, false, fmt.Errorf("download %w", errTooLarge)
+	}
+	return d.finish(item, e, partial, final, offset+n)
+}
+
+// finish moves a complete download into place and records it
+func (d *downloader) finish(item FeedItem, e Enclosure, partial, final string, size int64) (DownloadRecord, bool, error) {
+	if err := os.Rename(partial, final); err != nil {
+		return DownloadRecord{}, false, err
+	}
+	rec := DownloadRecord{
+		URL:      e.URL,
+		ItemID:   item.ID,
+		Feed:     item.Feed,
+		Path:     final,
+		Size:     size,
+		Finished: time.Now(),
+	}
+	return rec, true, d.record(rec)
+}
+
+// rangeStart returns the first byte position of a 206 response, or -1
+func rangeStart(resp *http.Response) int64 {
+	cr := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	if i := strings.IndexByte(cr, '-'); i > 0 {
+		if n, err := strconv.ParseInt(cr[:i], 10, 64); err == nil {
+			return n
+		}
+	}
+	return -1
+}
+
+// enclosureFileName derives a local file name from the enclosure URL,
+// adding an extension for its MIME type if the URL has none. A short hash
+// of the URL keeps episodes that share a file name apart.
+func enclosureFileName(e Enclosure) string {
+	sum := sha256.Sum256([]byte(e.URL))
+	hash := hex.EncodeToString(sum[:4])
+
+	name := ""
+	if u, err := url.Parse(e.URL); err == nil {
+		name = path.Base(u.Path)
+	}
+	if name == "." || name == "/" {
+		name = ""
+	}
+	name = safeFileName(name, "enclosure")
+	if filepath.Ext(name) == "" && e.Type != "" {
+		if exts, _ := mime.ExtensionsByType(e.Type); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return hash + "-" + name
+}
+
+// safeFileName replaces characters that are not allowed in file names on
+// common systems and shortens s, returning fallback if nothing is left
+func safeFileName(s, fallback string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, " .")
+	if runes := []rune(s); len(runes) > 100 {
+		s = string(runes[:100])
+	}
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// downloadJob is one enclosure to fetch and the item it belongs to
+type downloadJob struct {
+	item      FeedItem
+	enclosure Enclosure
+}
+
+// downloadJobs lists the enclosures of items, each URL once. Downloads of
+// the same URL would otherwise append to the same partial file at once.
+func downloadJobs(items []FeedItem) []downloadJob {
+	var jobs []downloadJob
+	seen := make(map[string]bool)
+	for _, item := range items {
+		for _, e := range item.Enclosures {
+			if seen[e.URL] {
+				continue
+			}
+			seen[e.URL] = true
+			jobs = append(jobs, downloadJob{item, e})
+		}
+	}
+	return jobs
+}
+
+// downloadOptions are the flags of rss download
+type downloadOptions struct {
+	dir     string
+	maxSize string
+	feed    string
+	since   string
+	limit   int
+	unread  bool
+}
+
+// register adds the download flags to fs
+func (o *downloadOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.dir, "dir", "", "Directory to download into, one subdirectory per feed (default <data-dir>/downloads)")
+	fs.StringVar(&o.maxSize, "max-size", "", "Skip enclosures larger than this (e.g. 500M)")
+	fs.StringVar(&o.feed, "feed", "", "Only items of feeds whose title contains this")
+	fs.StringVar(&o.since, "since", "", "Only items published since, or within a range ("+timeExprHelp+")")
+	fs.IntVarP(&o.limit, "limit", "n", 10, "Download enclosures of at most this many items")
+	fs.BoolVar(&o.unread, "unread", false, "Only unread items")
+}
+
+// cmdDownload downloads the enclosures of the items args refer to, or of
+// the newest items matching the filters
+func cmdDownload(cfg *Config, store *FeedStore, opts downloadOptions, args []string) error {
+	var max int64
+	if opts.maxSize != "" {
+		var err error
+		if max, err = parseSize(opts.maxSize); err != nil {
+			return usagef("--max-size: %v", err)
+		}
+	}
+	dir := opts.dir
+	if dir == "" {
+		dir = filepath.Join(cfg.DataDir, "downloads")
+	}
+
+	// Items named on the command line, or the newest with enclosures
+	var items []FeedItem
+	if len(args) > 0 {
+		for _, ref := range args {
+			item, err := resolveItem(cfg.DataDir, store, ref)
+			if err != nil {
+				return err
+			}
+			if len(item.Enclosures) == 0 {
+				return fmt.Errorf("%q has no enclosures", item.Title)
+			}
+			items = append(items, item)
+		}
+	} else {
+		list := ListOptions{Feed: opts.feed, Unread: opts.unread, Reverse: true}
+		if opts.since != "" {
+			window, err := parseTimeRange(opts.since, time.Now())
+			if err != nil {
+				return usagef("--since: %v", err)
+			}
+			list.Since, list.Until = window.From, window.Until
+		}
+		for _, item := range store.ListWith(list) {
+			if len(item.Enclosures) > 0 && (opts.limit <= 0 || len(items) < opts.limit) {
+				items = append(items, item)
+			}
+		}
+	}
+	if len(items) == 0 {
+		fmt.Println("No items with enclosures")
+		return nil
+	}
+
+	fetcher, err := newConfiguredFetcher(cfg, store)
+	if err != nil {
+		return err
+	}
+	d, err := newDownloader(fetcher, cfg.DataDir, dir, max)
+	if err != nil {
+		return err
+	}
+
+	// Interrupting keeps the partial files for the next run
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		wg     sync.WaitGroup
+		outMu  sync.Mutex
+		failed int
+	)
+	for _, job := range downloadJobs(items) {
+		wg.Add(1)
+		go func(item FeedItem, e Enclosure) {
+			defer wg.Done()
+
+			// Share the fetcher's limit on concurrent requests
+			select {
+			case fetcher.sem <- struct{}{}:
+				defer func() { <-fetcher.sem }()
+			case <-ctx.Done():
+				return
+			}
+
+			rec, fetched, err := d.download(ctx, item, e)
+
+			outMu.Lock()
+			defer outMu.Unlock()
+			switch {
+			case err != nil:
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", item.Title, redact(e.URL), redact(err.Error()))
+			case fetched:
+				fmt.Printf("Downloaded %s (%s)\n", rec.Path, formatBytes(rec.Size))
+			default:
+				fmt.Printf("Already downloaded %s\n", rec.Path)
+			}
+		}(job.item, job.enclosure)
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d downloads failed", failed)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"512", 512, true},
+		{"10K", 10 << 10, true},
+		{"1.5M", 3 << 19, true},
+		{"2 GiB", 2 << 30, true},
+		{"500mb", 500 << 20, true},
+		{"", 0, false},
+		{"-1M", 0, false},
+		{"lots", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseItunesDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"90", 90 * time.Second},
+		{"05:30", 5*time.Minute + 30*time.Second},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"", 0},
+		{"1:xx", 0},
+	}
+	for _, tt := range tests {
+		if got := parseItunesDuration(tt.in); got != tt.want {
+			t.Errorf("parseItunesDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEnclosureFileName(t *testing.T) {
+	tests := []struct {
+		enc  Enclosure
+		want string
+	}{
+		{Enclosure{URL: "https://cdn.test/ep/42.mp3"}, "-42.mp3"},
+		{Enclosure{URL: "https://cdn.test/ep/42", Type: "audio/mpeg"}, "-42.mp"},
+		{Enclosure{URL: "https://cdn.test/"}, "-enclosure"},
+		{Enclosure{URL: "https://cdn.test/a:b?.mp3"}, "-a_b"},
+	}
+	for _, tt := range tests {
+		got := enclosureFileName(tt.enc)
+		if len(got) < 8 || !strings.HasPrefix(got[8:], tt.want) {
+			t.Errorf("enclosureFileName(%q) = %q, want hash%s...", tt.enc.URL, got, tt.want)
+		}
+	}
+	a := enclosureFileName(Enclosure{URL: "https://one.test/ep.mp3"})
+	b := enclosureFileName(Enclosure{URL: "https://two.test/ep.mp3"})
+	if a == b {
+		t.Errorf("same file name %q for different URLs", a)
+	}
+}
+
+func TestDownloadJobsDedupesURLs(t *testing.T) {
+	items := []FeedItem{
+		{ID: "1", Enclosures: []Enclosure{{URL: "https://cdn.test/a.mp3"}, {URL: "https://cdn.test/a.mp3"}}},
+		{ID: "2", Enclosures: []Enclosure{{URL: "https://cdn.test/b.mp3"}, {URL: "https://cdn.test/a.mp3"}}},
+	}
+	var got []string
+	for _, job := range downloadJobs(items) {
+		got = append(got, job.item.ID+" "+job.enclosure.URL)
+	}
+	want := "1 https://cdn.test/a.mp3,2 https://cdn.test/b.mp3"
+	if strings.Join(got, ",") != want {
+		t.Errorf("jobs = %q, want %s", got, want)
+	}
+}
+
+func TestDownloadResumesPartialFile(t *testing.T) {
+	const content = "0123456789abcdefghij"
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "ep.mp3", time.Time{}, strings.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dataDir := t.TempDir()
+	d, err := newDownloader(NewFetcher(newTestStore(t, 10)), dataDir, t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := FeedItem{ID: "ep", Feed: "Show"}
+	e := Enclosure{URL: srv.URL + "/ep.mp3"}
+
+	final := filepath.Join(d.dir, "Show", enclosureFileName(e))
+	if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(final+".part", []byte(content[:8]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, fetched, err := d.download(context.Background(), item, e)
+	if err != nil || !fetched {
+		t.Fatalf("download = %v, %v", fetched, err)
+	}
+	if data, _ := os.ReadFile(rec.Path); string(data) != content {
+		t.Errorf("file = %q, want %q", data, content)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=8-" {
+		t.Errorf("Range headers = %q, want [bytes=8-]", ranges)
+	}
+
+	// Recorded downloads are not fetched again
+	if _, fetched, err := d.download(context.Background(), item, e); err != nil || fetched {
+		t.Errorf("second download = %v, %v; want already downloaded", fetched, err)
+	}
+	if len(ranges) != 1 {
+		t.Errorf("%d requests, want 1", len(ranges))
+	}
+}
+
+func TestDownloadSizeLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer srv.Close()
+
+	d, err := newDownloader(NewFetcher(newTestStore(t, 10)), t.TempDir(), t.TempDir(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := FeedItem{ID: "ep", Feed: "Show"}
+	for _, e := range []Enclosure{{URL: srv.URL + "/declared", Length: 4096}, {URL: srv.URL + "/actual"}} {
+		if _, _, err := d.download(context.Background(), item, e); err == nil || !strings.Contains(err.Error(), errTooLarge.Error()) {
+			t.Errorf("%s: err = %v, want %v", e.URL, err, errTooLarge)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// export.go holds the registry of output formats for item listings
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exporter writes a listing of items in one format
+type exporter struct {
+	write func(w io.Writer, items []FeedItem, showFeed bool) error
+	exts  []string // file extensions that select this format
+}
+
+// exporters maps -o names to their exporter. Adding a format means adding
+// an entry here.
+var exporters = map[string]exporter{
+	"table":    {outputTable, []string{".txt"}},
+	"json":     {outputJSON, []string{".json"}},
+	"csv":      {outputCSV, []string{".csv"}},
+	"jsonl":    {outputJSONLines, []string{".jsonl", ".ndjson"}},
+	"markdown": {outputMarkdown, []string{".md", ".markdown"}},
+	"html":     {outputHTML, []string{".html", ".htm"}},
+	"atom":     {outputAtom, []string{".atom", ".xml"}},
+}
+
+// exporterNames returns the registered format names, sorted
+func exporterNames() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exportItems writes items in format to path, or to stdout if path is
+// empty. Without a format it is taken from the path's extension, falling
+// back to table.
+func exportItems(format, path string, items []FeedItem, showFeed bool) error {
+	if format == "" {
+		format = "table"
+		ext := strings.ToLower(filepath.Ext(path))
+		for name, e := range exporters {
+			for _, x := range e.exts {
+				if x == ext {
+					format = name
+				}
+			}
+		}
+	}
+	e, ok := exporters[format]
+	if !ok {
+		return fmt.Errorf("unknown output format %q (want one of %s)", format, strings.Join(exporterNames(), ", "))
+	}
+
+	if path == "" {
+		return e.write(os.Stdout, items, showFeed)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := e.write(f, items, showFeed); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d items to %s\n", len(items), path)
+	return nil
+}
+
+// outputJSONLines writes one JSON object per item
+func outputJSONLines(w io.Writer, items []FeedItem, showFeed bool) error {
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportGroup is the items of one feed in a Markdown or HTML export
+type exportGroup struct {
+	Feed  string
+	Items []exportItem
+}
+
+// exportItem is an item with its content as plain text
+type exportItem struct {
+	FeedItem
+	Text string
+}
+
+// groupByFeed groups items by feed in order of first appearance, keeping
+// the listing's order within each feed
+func groupByFeed(items []FeedItem) []exportGroup {
+	var groups []exportGroup
+	index := make(map[string]int)
+	for _, item := range items {
+		i, ok := index[item.Feed]
+		if !ok {
+			i = len(groups)
+			index[item.Feed] = i
+			groups = append(groups, exportGroup{Feed: item.Feed})
+		}
+		groups[i].Items = append(groups[i].Items, exportItem{
+			FeedItem: item,
+			Text:     cleanText(item.Content),
+		})
+	}
+	return groups
+}
+
+// markdownEscaper escapes the characters that would start Markdown markup
+// inside link text and list items
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;",
+)
+
+// outputMarkdown writes items as a Markdown document with a section per feed
+func outputMarkdown(w io.Writer, items []FeedItem, showFeed bool) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# RSS export\n\n%d items, exported %s\n", len(items), time.Now().Format("2006-01-02 15:04"))
+	for _, g := range groupByFeed(items) {
+		fmt.Fprintf(&b, "\n## %s\n\n", markdownEscaper.Replace(g.Feed))
+		for _, item := range g.Items {
+			title := markdownEscaper.Replace(item.Title)
+			if item.Link != "" {
+				title = "[" + title + "](<" + item.Link + ">)"
+			}
+			fmt.Fprintf(&b, "- %s — %s", title, item.Published.Format("2006-01-02"))
+			if item.Author != "" {
+				fmt.Fprintf(&b, " · %s", markdownEscaper.Replace(item.Author))
+			}
+			if len(item.Tags) > 0 {
+				fmt.Fprintf(&b, " · #%s", strings.Join(item.Tags, " #"))
+			}
+			b.WriteString("\n")
+			if item.Text != "" {
+				fmt.Fprintf(&b, "\n  > %s\n\n", markdownEscaper.Replace(item.Text))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var exportHTML = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>RSS export</title>
+<style>
+body { font-family: sans-serif; max-width: 45em; margin: 2em auto; line-height: 1.4 }
+.meta { color: #666; font-size: smaller }
+article { margin-bottom: 1.5em }
+</style></head>
+<body>
+<h1>RSS export</h1>
+<p class="meta">{{.Count}} items, exported {{.Exported.Format "2006-01-02 15:04"}}</p>
+{{range .Groups}}<section>
+<h2>{{.Feed}}</h2>
+{{range .Items}}<article>
+<h3>{{if .Link}}<a href="{{.Link}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h3>
+<p class="meta">{{.Published.Format "2006-01-02 15:04"}}{{with .Author}} · {{.}}{{end}}{{range .Tags}} #{{.}}{{end}}</p>
+{{with .Text}}<p>{{.}}</p>{{end}}
+</article>
+{{end}}</section>
+{{end}}</body></html>
+`))
+
+// outputHTML writes items as a standalone HTML page with a section per feed
+func outputHTML(w io.Writer, items []FeedItem, showFeed bool) error {
+	return exportHTML.Execute(w, struct {
+		Count    int
+		Exported time.Time
+		Groups   []exportGroup
+	}{len(items), time.Now(), groupByFeed(items)})
+}
+
+// outputAtom writes items as a complete Atom archive document
+func outputAtom(w io.Writer, items []FeedItem, showFeed bool) error {
+	return writeAtom(w, feedInfo{
+		Title:   "RSS archive",
+		Updated: latestAdded(items),
+		Archive: true,
+	}, items)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// checkGolden compares got with testdata/golden/name, or rewrites the
+// file with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file\n got:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// exportFixture is a listing covering what the exporters render: two
+// feeds, markup in titles and content, tags, enclosures and read state
+func exportFixture() []FeedItem {
+	day := time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC)
+	return []FeedItem{
+		{
+			Feed: "Example Blog", Title: "First post", Link: "https://example.com/blog/posts/first",
+			Published: day, Added: day.Add(time.Hour), ID: "https://example.com/blog/posts/first",
+			Author: "Ana Example", Categories: []string{"go"}, Content: "<p>Hello, <b>world</b></p>",
+		},
+		{
+			Feed: "Example Blog", Title: "Second post & <more>", Link: "https://example.com/blog/posts/second?a=1&b=2",
+			Published: day.Add(24 * time.Hour), Added: day.Add(25 * time.Hour), ID: "tag:example.com,2024:2",
+			Read: true, Tags: []string{"later"}, AlsoIn: []string{"Planet Go"},
+			Content: "<ul><li>one</li><li>two</li></ul>",
+		},
+		{
+			Feed: "Podcast", Title: "Episode 1", Link: "https://pod.example.net/1",
+			Published: day.Add(48 * time.Hour), Added: day.Add(49 * time.Hour), ID: "pod-1",
+			Starred: true,
+			Enclosures: []Enclosure{{
+				URL: "https://pod.example.net/1.mp3", Type: "audio/mpeg", Length: 12345678, Duration: 62 * time.Minute,
+			}},
+		},
+	}
+}
+
+// exportedAt matches the export time in the HTML and Markdown output
+var exportedAt = regexp.MustCompile(`exported \d{4}-\d\d-\d\d \d\d:\d\d`)
+
+func TestExportersGolden(t *testing.T) {
+	for _, name := range exporterNames() {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := exporters[name].write(&buf, exportFixture(), true); err != nil {
+				t.Fatal(err)
+			}
+			got := exportedAt.ReplaceAll(buf.Bytes(), []byte("exported 2000-01-01 00:00"))
+			checkGolden(t, "export."+name, got)
+		})
+	}
+}
+
+func TestExportEmpty(t *testing.T) {
+	for _, name := range exporterNames() {
+		var buf bytes.Buffer
+		if err := exporters[name].write(&buf, nil, false); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestExportItemsFormatFromExtension(t *testing.T) {
+	dir := t.TempDir()
+	for ext, name := range map[string]string{".md": "markdown", ".jsonl": "jsonl", ".atom": "atom", ".unknown": "table"} {
+		path := filepath.Join(dir, "out"+ext)
+		if err := exportItems("", path, exportFixture(), true); err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		var want bytes.Buffer
+		exporters[name].write(&want, exportFixture(), true)
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The two writes may fall either side of a minute boundary
+		got = exportedAt.ReplaceAll(got, nil)
+		if !bytes.Equal(got, exportedAt.ReplaceAll(want.Bytes(), nil)) {
+			t.Errorf("%s was not written as %s", ext, name)
+		}
+	}
+
+	if err := exportItems("yaml", "", nil, false); err == nil {
+		t.Error("unknown format: no error")
+	}
+}
+
+func TestExporterExtensionsUnique(t *testing.T) {
+	seen := make(map[string]string)
+	for _, name := range exporterNames() {
+		for _, ext := range exporters[name].exts {
+			if other, ok := seen[ext]; ok {
+				t.Errorf("%s is claimed by both %s and %s", ext, other, name)
+			}
+			seen[ext] = name
+		}
+	}
+}
+
+func TestGroupByFeed(t *testing.T) {
+	items := []FeedItem{testItem("B", 1), testItem("A", 2), testItem("B", 3), testItem("C", 4), testItem("A", 5)}
+	want := []struct {
+		feed string
+		ids  []string
+	}{
+		{"B", []string{"B-1", "B-3"}},
+		{"A", []string{"A-2", "A-5"}},
+		{"C", []string{"C-4"}},
+	}
+	groups := groupByFeed(items)
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for i, g := range groups {
+		var got []string
+		for _, item := range g.Items {
+			got = append(got, item.ID)
+		}
+		if g.Feed != want[i].feed || fmt.Sprint(got) != fmt.Sprint(want[i].ids) {
+			t.Errorf("group %d = %s %v, want %s %v", i, g.Feed, got, want[i].feed, want[i].ids)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFeedServer serves the fixtures in testdata/feeds and simulates what
+// feed servers do:
+//
+//	/feed/<file>           the fixture, with ETag and Last-Modified; 304 when unchanged
+//	/moved/<file>          301 to /feed/<file>
+//	/temp/<file>           302 to /feed/<file>
+//	/slow/<delay>/<file>   the fixture after delay, e.g. /slow/200ms/rss2.xml
+//	/status/<code>         an empty response with that status
+//	/gen/<n>/<k>.xml       a generated RSS feed k with n items
+type fakeFeedServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	requests    map[string]int // by path
+	conditional map[string]int // requests carrying If-None-Match or If-Modified-Since
+}
+
+// lastModified is the Last-Modified time of every fixture
+var lastModified = time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+
+func newFakeFeedServer(t *testing.T) *fakeFeedServer {
+	t.Helper()
+	s := &fakeFeedServer{requests: make(map[string]int), conditional: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// URLFor returns the absolute URL of path on the server
+func (s *fakeFeedServer) URLFor(path string) string {
+	return s.Server.URL + path
+}
+
+// Requests returns how many requests path received
+func (s *fakeFeedServer) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Conditional returns how many requests for path were conditional
+func (s *fakeFeedServer) Conditional(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conditional[path]
+}
+
+func (s *fakeFeedServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		s.conditional[r.URL.Path]++
+	}
+	s.mu.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	switch parts[0] {
+	case "feed":
+		s.serveFixture(w, r, parts[1])
+	case "moved":
+		http.Redirect(w, r, "/feed/"+parts[1], http.StatusMovedPermanently)
+	case "temp":
+		http.Redirect(w, r, "/feed/"+parts[1], http.StatusFound)
+	case "slow":
+		delay, err := time.ParseDuration(parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		select {
+		case <-time.After(delay):
+			s.serveFixture(w, r, parts[2])
+		case <-r.Context().Done():
+		}
+	case "status":
+		code, err := strconv.Atoi(parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(code)
+	case "gen":
+		n, _ := strconv.Atoi(parts[1])
+		feed := strings.TrimSuffix(parts[2], ".xml")
+		s.serveBody(w, r, generatedFeed(feed, n))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveFixture serves testdata/feeds/name
+func (s *fakeFeedServer) serveFixture(w http.ResponseWriter, r *http.Request, name string) {
+	data, err := os.ReadFile(filepath.Join("testdata", "feeds", filepath.Base(name)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveBody(w, r, data)
+}
+
+// serveBody writes body with validators, or 304 if the request's validators match
+func (s *fakeFeedServer) serveBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(body)
+}
+
+// generatedFeed returns an RSS feed titled name with n items, one per
+// hour
+func generatedFeed(name string, n int) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0"?><rss version="2.0"><channel><title>%s</title>`, name)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<item><title>%s item %d</title><link>https://gen.test/%s/%d</link><pubDate>%s</pubDate></item>`,
+			name, i, name, i, start.Add(time.Duration(i)*time.Hour).Format(time.RFC1123Z))
+	}
+	b.WriteString(`</channel></rss>`)
+	return []byte(b.String())
+}
@@ -0,0 +1,304 @@
+// feedgen.go renders stored items as Atom, RSS 2.0 and JSON Feed documents
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// feedInfo describes a generated feed
+type feedInfo struct {
+	Title   string
+	SelfURL string // URL the document is served from, if any
+	HomeURL string
+	Updated time.Time
+	Archive bool // mark the document as a complete RFC 5005 archive
+}
+
+// latestAdded returns the most recent Added time among items, which is
+// when the generated feed last changed
+func latestAdded(items []FeedItem) time.Time {
+	var latest time.Time
+	for _, item := range items {
+		if item.Added.After(latest) {
+			latest = item.Added
+		}
+	}
+	return latest
+}
+
+// atomID returns an Atom entry ID for item; Atom requires an IRI
+func atomID(item FeedItem) string {
+	if strings.Contains(item.ID, ":") {
+		return item.ID
+	}
+	return "tag:rss-cli,2023:" + item.ID
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Archive *struct{}   `xml:"http://purl.org/syndication/history/1.0 archive,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Links      []atomLink     `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    *atomText      `xml:"content,omitempty"`
+	Source     *atomSource    `xml:"source,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomSource struct {
+	Title string `xml:"title"`
+}
+
+// writeAtom writes items as an Atom 1.0 feed
+func writeAtom(w io.Writer, info feedInfo, items []FeedItem) error {
+	feed := atomFeed{
+		Title:   info.Title,
+		ID:      info.SelfURL,
+		Updated: info.Updated.UTC().Format(time.RFC3339),
+	}
+	if feed.ID == "" {
+		feed.ID = "tag:rss-cli,2023:" + url.PathEscape(info.Title)
+	}
+	if info.SelfURL != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "self", Href: info.SelfURL})
+	}
+	if info.HomeURL != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "alternate", Href: info.HomeURL})
+	}
+	if info.Archive {
+		feed.Archive = &struct{}{}
+	}
+
+	for _, item := range items {
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        atomID(item),
+			Updated:   item.Published.UTC().Format(time.RFC3339),
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Source:    &atomSource{Title: item.Feed},
+		}
+		if item.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Href: item.Link})
+		}
+		for _, e := range item.Enclosures {
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Href: e.URL, Type: e.Type, Length: e.Length})
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		}
+		for _, c := range append(append([]string{}, item.Categories...), item.Tags...) {
+			entry.Categories = append(entry.Categories, atomCategory{Term: c})
+		}
+		if item.Content != "" {
+			entry.Content = &atomText{Type: "html", Body: item.Content}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return encodeXML(w, feed)
+}
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Description   string     `xml:"description"`
+	LastBuildDate string     `xml:"lastBuildDate"`
+	SelfLink      *rssAtomLn `xml:"atom:link,omitempty"`
+	Items         []rssItem  `xml:"item"`
+}
+
+type rssAtomLn struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Creator     string        `xml:"dc:creator,omitempty"`
+	Categories  []string      `xml:"category"`
+	Description string        `xml:"description,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+	Source      string        `xml:"source,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// writeRSS writes items as an RSS 2.0 feed
+func writeRSS(w io.Writer, info feedInfo, items []FeedItem) error {
+	doc := rssDoc{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         info.Title,
+			Link:          info.HomeURL,
+			Description:   info.Title,
+			LastBuildDate: info.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+	if info.SelfURL != "" {
+		doc.Channel.SelfLink = &rssAtomLn{Href: info.SelfURL, Rel: "self", Type: "application/rss+xml"}
+	}
+
+	for _, item := range items {
+		ri := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: false, Value: item.ID},
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+			Creator:     item.Author,
+			Categories:  append(append([]string{}, item.Categories...), item.Tags...),
+			Description: item.Content,
+			Source:      item.Feed,
+		}
+		// RSS 2.0 allows a single enclosure per item
+		if len(item.Enclosures) > 0 {
+			e := item.Enclosures[0]
+			ri.Enclosure = &rssEnclosure{URL: e.URL, Type: e.Type, Length: e.Length}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, ri)
+	}
+
+	return encodeXML(w, doc)
+}
+
+// encodeXML writes v as an indented XML document
+func encodeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttach `json:"attachments,omitempty"`
+	Source        string           `json:"_source,omitempty"` // originating feed
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedAttach struct {
+	URL      string  `json:"url"`
+	MIMEType string  `json:"mime_type"`
+	Size     int64   `json:"size_in_bytes,omitempty"`
+	Duration float64 `json:"duration_in_seconds,omitempty"`
+}
+
+// writeJSONFeed writes items as a JSON Feed 1.1 document
+func writeJSONFeed(w io.Writer, info feedInfo, items []FeedItem) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       info.Title,
+		HomePageURL: info.HomeURL,
+		FeedURL:     info.SelfURL,
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, item := range items {
+		ji := jsonFeedItem{
+			ID:            item.ID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			DatePublished: item.Published.UTC().Format(time.RFC3339),
+			Tags:          append(append([]string{}, item.Categories...), item.Tags...),
+			Source:        item.Feed,
+		}
+		if item.Author != "" {
+			ji.Authors = []jsonFeedAuthor{{Name: item.Author}}
+		}
+		for _, e := range item.Enclosures {
+			ji.Attachments = append(ji.Attachments, jsonFeedAttach{
+				URL:      e.URL,
+				MIMEType: e.Type,
+				Size:     e.Length,
+				Duration: e.Duration.Seconds(),
+			})
+		}
+		feed.Items = append(feed.Items, ji)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(feed)
+}
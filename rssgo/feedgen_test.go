@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAtomID(t *testing.T) {
+	tests := map[string]string{
+		"https://blog.test/1":     "https://blog.test/1",
+		"tag:blog.test,2024:1":    "tag:blog.test,2024:1",
+		"5f2b1c":                  "tag:rss-cli,2023:5f2b1c",
+		"urn:uuid:1234-5678-9abc": "urn:uuid:1234-5678-9abc",
+	}
+	for id, want := range tests {
+		if got := atomID(FeedItem{ID: id}); got != want {
+			t.Errorf("atomID(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestLatestAdded(t *testing.T) {
+	items := []FeedItem{testItem("A", 5), testItem("A", 9), testItem("A", 2)}
+	if got := latestAdded(items); !got.Equal(items[1].Added) {
+		t.Errorf("latestAdded = %v, want %v", got, items[1].Added)
+	}
+	if got := latestAdded(nil); !got.IsZero() {
+		t.Errorf("latestAdded(nil) = %v, want zero", got)
+	}
+}
+
+// TestGeneratedFeedsRoundTrip parses each generated format back with the
+// reader's own parser
+func TestGeneratedFeedsRoundTrip(t *testing.T) {
+	item := testItem("Blog", 3)
+	item.ID = "https://blog.test/posts/3"
+	item.Title = `Ampersands & "quotes"`
+	item.Author = "Jane"
+	item.Categories = []string{"go", "xml"}
+	item.Content = "<p>Body & soul</p>"
+	item.Enclosures = []Enclosure{{URL: "https://cdn.test/3.mp3", Type: "audio/mpeg", Length: 4096}}
+	info := feedInfo{
+		Title:   "All items",
+		SelfURL: "https://rss.test/feed",
+		HomeURL: "https://rss.test/",
+		Updated: item.Added,
+	}
+
+	for ext, format := range feedFormats {
+		var buf bytes.Buffer
+		if err := format.write(&buf, info, []FeedItem{item}); err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		items, err := parseFeed(bytes.NewReader(buf.Bytes()), info.SelfURL+"."+ext)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", ext, err, buf.String())
+		}
+		if len(items) != 1 {
+			t.Fatalf("%s: %d items, want 1", ext, len(items))
+		}
+		got := items[0]
+		if got.Title != item.Title || got.Link != item.Link || got.ID != item.ID {
+			t.Errorf("%s: item = %q %q %q, want %q %q %q", ext, got.Title, got.Link, got.ID, item.Title, item.Link, item.ID)
+		}
+		if !got.Published.Equal(item.Published) {
+			t.Errorf("%s: published = %v, want %v", ext, got.Published, item.Published)
+		}
+		if !strings.Contains(got.Content, "Body &amp; soul") && !strings.Contains(got.Content, "Body & soul") {
+			t.Errorf("%s: content = %q", ext, got.Content)
+		}
+		if !slices.Equal(got.Categories, item.Categories) {
+			t.Errorf("%s: categories = %q, want %q", ext, got.Categories, item.Categories)
+		}
+		if len(got.Enclosures) != 1 || got.Enclosures[0].URL != item.Enclosures[0].URL || got.Enclosures[0].Length != 4096 {
+			t.Errorf("%s: enclosures = %+v, want %+v", ext, got.Enclosures, item.Enclosures)
+		}
+	}
+}
+
+func TestAtomArchiveAndUpdated(t *testing.T) {
+	var buf bytes.Buffer
+	updated := time.Date(2024, 5, 8, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	if err := writeAtom(&buf, feedInfo{Title: "Archive", Updated: updated, Archive: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<updated>2024-05-08T10:00:00Z</updated>",
+		"<id>tag:rss-cli,2023:Archive</id>",
+		`archive xmlns="http://purl.org/syndication/history/1.0"`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("atom lacks %s:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// feedmeta.go keeps per-feed metadata alongside the item store
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// metaFile is the name of the metadata file next to feeds.json
+const metaFile = "meta.json"
+
+// Meta returns a copy of the metadata of every known feed, sorted by URL
+func (s *FeedStore) Meta() []FeedMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metas := make([]FeedMeta, 0, len(s.meta))
+	for _, m := range s.meta {
+		metas = append(metas, *m)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].URL < metas[j].URL
+	})
+	return metas
+}
+
+// MetaFor returns a copy of the metadata for url
+func (s *FeedStore) MetaFor(url string) (FeedMeta, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.meta[url]
+	if !ok {
+		return FeedMeta{URL: url}, false
+	}
+	return *m, true
+}
+
+// Subscriptions returns the URLs of all known feeds that are not dead
+func (s *FeedStore) Subscriptions() []string {
+	var urls []string
+	for _, m := range s.Meta() {
+		if !m.Dead {
+			urls = append(urls, m.URL)
+		}
+	}
+	return urls
+}
+
+// RemoveFeed forgets the subscription url. With purge, the items stored
+// under the feed's title are deleted as well.
+func (s *FeedStore) RemoveFeed(url string, purge bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.meta[url]
+	if !ok {
+		return fmt.Errorf("unknown feed %s", url)
+	}
+	delete(s.meta, url)
+
+	if purge && m.Title != "" {
+		kept := s.items[:0]
+		for _, item := range s.items {
+			if item.Feed != m.Title {
+				kept = append(kept, item)
+			}
+		}
+		s.items = kept
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	return s.saveMeta()
+}
+
+// UpdateMeta applies fn to the metadata of url, creating it if needed,
+// and persists the result
+func (s *FeedStore) UpdateMeta(url string, fn func(m *FeedMeta)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.meta[url]
+	if !ok {
+		m = &FeedMeta{URL: url}
+		s.meta[url] = m
+	}
+	fn(m)
+
+	return s.saveMeta()
+}
+
+// metaPath returns the path of the metadata file
+func (s *FeedStore) metaPath() string {
+	return filepath.Join(filepath.Dir(s.path), metaFile)
+}
+
+// loadMeta loads feed metadata from disk
+func (s *FeedStore) loadMeta() error {
+	data, err := os.ReadFile(s.metaPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	meta := make(map[string]*FeedMeta)
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.meta = meta
+	s.mu.Unlock()
+
+	return nil
+}
+
+// saveMeta saves feed metadata to disk; the caller must hold s.mu
+func (s *FeedStore) saveMeta() error {
+	data, err := json.MarshalIndent(s.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write atomically
+	tmpPath := s.metaPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.metaPath())
+}
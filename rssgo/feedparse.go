@@ -0,0 +1,395 @@
+// feedparse.go detects the format of a fetched feed and parses Atom and
+// JSON Feed documents; RSS 2.0 and RSS 1.0 (RDF) are parsed by parseRSS
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// errUnknownFormat is returned for documents that are not a feed
+var errUnknownFormat = errors.New("not an RSS, Atom, RDF or JSON feed")
+
+// parseFeed parses an RSS 2.0, RSS 1.0 (RDF), Atom or JSON Feed document
+func parseFeed(r io.Reader, url string) ([]FeedItem, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJSONFeed(data, url)
+	}
+
+	root, err := xmlRoot(data)
+	if err != nil {
+		return nil, err
+	}
+	switch root {
+	case "feed":
+		return parseAtom(data, url)
+	case "rss", "RDF":
+		return parseRSS(data, url)
+	}
+	return nil, fmt.Errorf("%w: root element <%s>", errUnknownFormat, root)
+}
+
+// feedAutoClose are the HTML void elements that turn up unescaped in feed
+// descriptions. xml.HTMLAutoClose would also close <link>, which RSS uses
+// for the item URL.
+var feedAutoClose = []string{"br", "hr", "img", "input", "area", "col", "param", "wbr"}
+
+// newFeedDecoder returns a decoder that tolerates what real-world feeds
+// get wrong: HTML entities, unescaped ampersands, unclosed HTML tags and
+// Latin-1 encodings
+func newFeedDecoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.AutoClose = feedAutoClose
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = charsetReader
+	return d
+}
+
+// decodeXML unmarshals a feed document with newFeedDecoder
+func decodeXML(data []byte, v any) error {
+	return newFeedDecoder(data).Decode(v)
+}
+
+// xmlRoot returns the local name of the document's root element
+func xmlRoot(data []byte) (string, error) {
+	d := newFeedDecoder(data)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return "", errUnknownFormat
+		}
+		if err != nil {
+			return "", err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// charsetReader decodes the single-byte encodings feeds still declare;
+// UTF-8 needs no decoding
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "latin-1", "l1":
+		return &singleByteReader{r: input}, nil
+	case "windows-1252", "cp1252":
+		return &singleByteReader{r: input, high: &cp1252}, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", label)
+}
+
+// cp1252 maps the bytes 0x80 to 0x9F of Windows-1252, where it differs
+// from Latin-1
+var cp1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// singleByteReader converts a Latin-1 or Windows-1252 stream to UTF-8
+type singleByteReader struct {
+	r    io.Reader
+	high *[32]rune // replaces 0x80 to 0x9F when set
+	buf  []byte
+}
+
+func (s *singleByteReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		raw := make([]byte, max(len(p)/2, 1))
+		n, err := s.r.Read(raw)
+		for _, b := range raw[:n] {
+			r := rune(b)
+			if s.high != nil && b >= 0x80 && b < 0xa0 {
+				r = s.high[b-0x80]
+			}
+			s.buf = append(s.buf, string(r)...)
+		}
+		if n == 0 && err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// atomInText is an Atom text construct as read from a feed
+type atomInText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",innerxml"`
+}
+
+// parseAtom parses an Atom 1.0 feed
+func parseAtom(data []byte, url string) ([]FeedItem, error) {
+	type atomInLink struct {
+		Rel    string `xml:"rel,attr"`
+		Href   string `xml:"href,attr"`
+		Type   string `xml:"type,attr"`
+		Length int64  `xml:"length,attr"`
+	}
+	var feed struct {
+		Base    string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+		Title   string `xml:"title"`
+		Author  string `xml:"author>name"`
+		Entries []struct {
+			Base       string       `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+			ID         string       `xml:"id"`
+			Title      atomInText   `xml:"title"`
+			Links      []atomInLink `xml:"link"`
+			Published  string       `xml:"published"`
+			Updated    string       `xml:"updated"`
+			Authors    []string     `xml:"author>name"`
+			Categories []struct {
+				Term  string `xml:"term,attr"`
+				Label string `xml:"label,attr"`
+			} `xml:"category"`
+			Content atomInText `xml:"content"`
+			Summary atomInText `xml:"summary"`
+		} `xml:"entry"`
+	}
+	if err := decodeXML(data, &feed); err != nil {
+		return nil, err
+	}
+
+	added := time.Now()
+	var badDates []string
+	var items []FeedItem
+	for _, e := range feed.Entries {
+		bases := []string{url, feed.Base, e.Base}
+
+		var link string
+		var enclosures []Enclosure
+		for _, l := range e.Links {
+			switch l.Rel {
+			case "", "alternate":
+				if link == "" {
+					link = resolveLink(l.Href, bases...)
+				}
+			case "enclosure":
+				if l.Href != "" {
+					enclosures = append(enclosures, Enclosure{
+						URL:    resolveLink(l.Href, bases...),
+						Type:   strings.TrimSpace(l.Type),
+						Length: l.Length,
+					})
+				}
+			}
+		}
+
+		date := e.Published
+		if date == "" {
+			date = e.Updated
+		}
+		published, err := parseDate(date)
+		if err != nil {
+			published = added
+			badDates = append(badDates, date)
+		}
+
+		id := strings.TrimSpace(e.ID)
+		if id == "" {
+			id = link
+		}
+		author := feed.Author
+		if len(e.Authors) > 0 {
+			author = e.Authors[0]
+		}
+		content := atomContent(e.Content)
+		if content == "" {
+			content = atomContent(e.Summary)
+		}
+		var categories []string
+		for _, c := range e.Categories {
+			name := c.Label
+			if name == "" {
+				name = c.Term
+			}
+			if name = cleanText(name); name != "" {
+				categories = append(categories, name)
+			}
+		}
+
+		items = append(items, FeedItem{
+			Feed:       cleanText(feed.Title),
+			Title:      cleanText(atomContent(e.Title)),
+			Link:       link,
+			Published:  published,
+			Added:      added,
+			ID:         id,
+			Author:     cleanText(author),
+			Categories: categories,
+			Content:    content,
+			Enclosures: enclosures,
+		})
+	}
+	warnBadDates(url, badDates)
+	return items, nil
+}
+
+// atomContent returns an Atom text construct as HTML. Text and escaped
+// HTML arrive as character data; XHTML arrives as markup inside a div.
+func atomContent(t atomInText) string {
+	body := strings.TrimSpace(t.Body)
+	if t.Type == "xhtml" {
+		if strings.HasPrefix(body, "<div") {
+			if i := strings.Index(body, ">"); i >= 0 {
+				body = strings.TrimSuffix(strings.TrimSpace(body[i+1:]), "</div>")
+			}
+		}
+		return strings.TrimSpace(body)
+	}
+	if strings.Contains(body, "&") || strings.Contains(body, "<![CDATA[") {
+		body = unescapeXML(body)
+	}
+	return strings.TrimSpace(body)
+}
+
+// unescapeXML decodes the character data of an element read as inner XML
+func unescapeXML(s string) string {
+	var out strings.Builder
+	d := newFeedDecoder([]byte("<x>" + s + "</x>"))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		if cd, ok := tok.(xml.CharData); ok {
+			out.Write(cd)
+		}
+	}
+	return out.String()
+}
+
+// parseJSONFeed parses a JSON Feed 1.0 or 1.1 document
+func parseJSONFeed(data []byte, url string) ([]FeedItem, error) {
+	type jsonAuthor struct {
+		Name string `json:"name"`
+	}
+	var feed struct {
+		Version string       `json:"version"`
+		Title   string       `json:"title"`
+		Author  *jsonAuthor  `json:"author"`
+		Authors []jsonAuthor `json:"authors"`
+		Items   []struct {
+			ID            json.RawMessage `json:"id"`
+			URL           string          `json:"url"`
+			ExternalURL   string          `json:"external_url"`
+			Title         string          `json:"title"`
+			ContentHTML   string          `json:"content_html"`
+			ContentText   string          `json:"content_text"`
+			Summary       string          `json:"summary"`
+			DatePublished string          `json:"date_published"`
+			DateModified  string          `json:"date_modified"`
+			Author        *jsonAuthor     `json:"author"`
+			Authors       []jsonAuthor    `json:"authors"`
+			Tags          []string        `json:"tags"`
+			Attachments   []struct {
+				URL      string  `json:"url"`
+				MimeType string  `json:"mime_type"`
+				Size     int64   `json:"size_in_bytes"`
+				Duration float64 `json:"duration_in_seconds"`
+			} `json:"attachments"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("JSON feed: %w", err)
+	}
+	if !strings.HasPrefix(feed.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("%w: JSON without a jsonfeed.org version", errUnknownFormat)
+	}
+
+	authorName := func(one *jsonAuthor, many []jsonAuthor) string {
+		if len(many) > 0 {
+			return many[0].Name
+		}
+		if one != nil {
+			return one.Name
+		}
+		return ""
+	}
+	feedAuthor := authorName(feed.Author, feed.Authors)
+
+	added := time.Now()
+	var badDates []string
+	var items []FeedItem
+	for _, it := range feed.Items {
+		link := it.URL
+		if link == "" {
+			link = it.ExternalURL
+		}
+		link = resolveLink(link, url)
+
+		// IDs should be strings, but some feeds publish numbers
+		var id string
+		if err := json.Unmarshal(it.ID, &id); err != nil {
+			id = strings.TrimSpace(string(it.ID))
+		}
+		if id == "" {
+			id = link
+		}
+
+		date := it.DatePublished
+		if date == "" {
+			date = it.DateModified
+		}
+		published, err := parseDate(date)
+		if err != nil {
+			published = added
+			badDates = append(badDates, date)
+		}
+
+		content := it.ContentHTML
+		if content == "" {
+			content = it.ContentText
+		}
+		if content == "" {
+			content = it.Summary
+		}
+		author := authorName(it.Author, it.Authors)
+		if author == "" {
+			author = feedAuthor
+		}
+		var enclosures []Enclosure
+		for _, a := range it.Attachments {
+			if a.URL == "" {
+				continue
+			}
+			enclosures = append(enclosures, Enclosure{
+				URL:      resolveLink(a.URL, url),
+				Type:     a.MimeType,
+				Length:   a.Size,
+				Duration: time.Duration(a.Duration * float64(time.Second)),
+			})
+		}
+
+		items = append(items, FeedItem{
+			Feed:       cleanText(feed.Title),
+			Title:      cleanText(it.Title),
+			Link:       link,
+			Published:  published,
+			Added:      added,
+			ID:         id,
+			Author:     cleanText(author),
+			Categories: it.Tags,
+			Content:    strings.TrimSpace(content),
+			Enclosures: enclosures,
+		})
+	}
+	warnBadDates(url, badDates)
+	return items, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureURL is the address fixtures are parsed as if fetched from
+const fixtureURL = "https://fixture.test/feed"
+
+// parseFixture parses testdata/feeds/name
+func parseFixture(t *testing.T, name string) ([]FeedItem, error) {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "feeds", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return parseFeed(f, fixtureURL)
+}
+
+// itemSummary is the part of a parsed item the fixture tests compare
+type itemSummary struct {
+	Feed, Title, Link, ID, Author, Content, Published string
+	Categories                                        []string
+}
+
+func summarize(item FeedItem) itemSummary {
+	return itemSummary{
+		Feed:       item.Feed,
+		Title:      item.Title,
+		Link:       item.Link,
+		ID:         item.ID,
+		Author:     item.Author,
+		Content:    item.Content,
+		Published:  item.Published.UTC().Format(time.RFC3339),
+		Categories: item.Categories,
+	}
+}
+
+func TestParseFeedFixtures(t *testing.T) {
+	tests := []struct {
+		file string
+		want []itemSummary
+	}{
+		{"rss2.xml", []itemSummary{
+			{
+				Feed: "Example Blog", Title: "Second post & more",
+				Link: "https://example.com/blog/posts/second", ID: "tag:example.com,2024:2",
+				Author: "Ana Example", Content: "<p>The <b>full</b> text.</p>",
+				Published: "2024-05-07T07:30:00Z", Categories: []string{"go", "testing"},
+			},
+			{
+				Feed: "Example Blog", Title: "First post",
+				Link: "https://example.com/blog/posts/first", ID: "https://example.com/blog/posts/first",
+				Author: "ana@example.com (Ana Example)", Content: "<p>Hello, world</p>",
+				Published: "2024-05-06T08:00:00Z",
+			},
+			{
+				Feed: "Example Blog", Title: "Episode 1",
+				Link: "https://example.com/episodes/1", ID: "https://example.com/episodes/1",
+				Author: "Podcast Host", Content: "Show notes",
+				Published: "2024-05-08T12:00:00Z",
+			},
+		}},
+		{"atom.xml", []itemSummary{
+			{
+				Feed: "Atom Example", Title: "Escaped HTML title",
+				Link: "https://atom.example.org/2024/05/escaped", ID: "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+				Author: "Feed Author", Content: "<p>Escaped &amp; content</p>",
+				Published: "2024-05-07T08:00:00Z", Categories: []string{"News"},
+			},
+			{
+				Feed: "Atom Example", Title: "XHTML entry",
+				Link: "https://other.example.org/posts/xhtml-entry", ID: "tag:atom.example.org,2024:xhtml",
+				Author: "Entry Author", Content: "<p>Inline <b>markup</b></p>",
+				Published: "2024-05-06T08:00:00Z", Categories: []string{"misc"},
+			},
+			{
+				Feed: "Atom Example", Title: "No link",
+				ID: "tag:atom.example.org,2024:nolink", Author: "Feed Author", Content: "Just text",
+				Published: "2024-05-05T08:00:00Z",
+			},
+		}},
+		{"rdf.xml", []itemSummary{
+			{
+				Feed: "RDF Site", Title: "Item A",
+				Link: "https://rdf.example.net/a", ID: "https://rdf.example.net/a",
+				Author: "RDF Writer", Content: "About A", Published: "2024-05-01T12:00:00Z",
+			},
+			{
+				Feed: "RDF Site", Title: "Item B",
+				Link: "https://rdf.example.net/b", ID: "https://rdf.example.net/b",
+				Published: "2024-05-02T12:00:00Z",
+			},
+		}},
+		{"feed.json", []itemSummary{
+			{
+				Feed: "JSON Example", Title: "HTML item",
+				Link: "https://json.example.com/1", ID: "1",
+				Author: "Feed Writer", Content: "<p>Hello</p>",
+				Published: "2024-05-03T10:00:00Z", Categories: []string{"json", "feeds"},
+			},
+			{
+				Feed: "JSON Example", Title: "Text item with attachment",
+				Link: "https://fixture.test/2", ID: "2",
+				Author: "Item Writer", Content: "Plain", Published: "2024-05-04T15:00:00Z",
+			},
+		}},
+		{"latin1.xml", []itemSummary{
+			{
+				Feed: "Café News", Title: "Crème brûlée recipe",
+				Link: "https://latin1.example.com/creme?a=1&b=2", ID: "https://latin1.example.com/creme?a=1&b=2",
+				Content: "Tom & Jerry  unclosed", Published: "2024-05-02T07:00:00Z",
+			},
+		}},
+		{"empty-channel.xml", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			items, err := parseFixture(t, tt.file)
+			if err != nil {
+				t.Fatalf("parseFeed: %v", err)
+			}
+			var got []itemSummary
+			for _, item := range items {
+				got = append(got, summarize(item))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("items differ\n got: %+v\nwant: %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFeedEnclosures(t *testing.T) {
+	tests := []struct {
+		file string
+		want Enclosure
+	}{
+		{"rss2.xml", Enclosure{URL: "https://example.com/blog/media/ep1.mp3", Type: "audio/mpeg", Length: 12345678, Duration: time.Hour + 2*time.Minute + 3*time.Second}},
+		{"atom.xml", Enclosure{URL: "https://atom.example.org/media/clip.ogg", Type: "audio/ogg", Length: 2048}},
+		{"feed.json", Enclosure{URL: "https://fixture.test/audio/2.mp3", Type: "audio/mpeg", Length: 1000, Duration: 90 * time.Second}},
+	}
+	for _, tt := range tests {
+		items, err := parseFixture(t, tt.file)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		var got []Enclosure
+		for _, item := range items {
+			got = append(got, item.Enclosures...)
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: enclosures = %+v, want [%+v]", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestParseFeedBadDates(t *testing.T) {
+	items, err := parseFixture(t, "bad-dates.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("got %d items, want 3", len(items))
+	}
+	if got := items[0].Published.UTC().Format(time.RFC3339); got != "2024-05-01T08:00:00Z" {
+		t.Errorf("localised date parsed as %s", got)
+	}
+	// Unparseable and missing dates fall back to the time the item was
+	// first seen
+	for _, item := range items[1:] {
+		if !item.Published.Equal(item.Added) {
+			t.Errorf("%s: published %v, want the added time %v", item.Title, item.Published, item.Added)
+		}
+	}
+}
+
+func TestParseFeedMalformed(t *testing.T) {
+	tests := []struct {
+		file    string
+		unknown bool // expect errUnknownFormat
+	}{
+		{"truncated.xml", false},
+		{"broken.json", false},
+		{"not-a-feed.html", true},
+	}
+	for _, tt := range tests {
+		items, err := parseFixture(t, tt.file)
+		if err == nil {
+			t.Errorf("%s: no error, got %d items", tt.file, len(items))
+			continue
+		}
+		if got := errors.Is(err, errUnknownFormat); got != tt.unknown {
+			t.Errorf("%s: error %q, unknown format = %v, want %v", tt.file, err, got, tt.unknown)
+		}
+	}
+
+	for _, doc := range []string{"", "   ", "plain text", `{"title": "no version"}`} {
+		if _, err := parseFeed(strings.NewReader(doc), fixtureURL); err == nil {
+			t.Errorf("parseFeed(%q): no error", doc)
+		}
+	}
+}
+
+func TestParseRSSLenient(t *testing.T) {
+	// Unescaped ampersands and HTML entities are common in hand-written
+	// feeds
+	doc := `<rss version="2.0"><channel><title>Q&A</title>
+<item><title>Fish &amp; chips &mdash; &eacute;t&eacute;</title><link>https://x.test/?a=1&b=2</link></item>
+</channel></rss>`
+	items, err := parseRSS([]byte(doc), fixtureURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("got %d items, want 1", len(items))
+	}
+	if want := "Fish & chips — été"; items[0].Title != want {
+		t.Errorf("title = %q, want %q", items[0].Title, want)
+	}
+	if want := "https://x.test/?a=1&b=2"; items[0].Link != want {
+		t.Errorf("link = %q, want %q", items[0].Link, want)
+	}
+	if items[0].Feed != "Q&A" {
+		t.Errorf("feed = %q, want Q&A", items[0].Feed)
+	}
+}
+
+func TestParseFeedCleansFeedTitle(t *testing.T) {
+	// Every format stores the feed title through cleanText, so entities
+	// and whitespace come out the same way
+	docs := map[string]string{
+		"rss": `<rss version="2.0"><channel><title>  Fish &amp;amp; Chips
+	Weekly </title><item><title>x</title><link>https://x.test/1</link></item></channel></rss>`,
+		"rdf": `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<channel><title>  Fish &amp;amp; Chips
+	Weekly </title></channel><item><title>x</title><link>https://x.test/1</link></item></rdf:RDF>`,
+		"atom": `<feed xmlns="http://www.w3.org/2005/Atom"><title>  Fish &amp;amp; Chips
+	Weekly </title><entry><id>1</id><title>x</title></entry></feed>`,
+		"json": `{"version": "https://jsonfeed.org/version/1.1", "title": "  Fish &amp; Chips\n\tWeekly ",
+"items": [{"id": "1", "title": "x"}]}`,
+	}
+	for format, doc := range docs {
+		items, err := parseFeed(strings.NewReader(doc), fixtureURL)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(items) != 1 || items[0].Feed != "Fish & Chips Weekly" {
+			t.Errorf("%s: feed titles = %q, want \"Fish & Chips Weekly\"", format, feedTitles(items))
+		}
+	}
+}
+
+func feedTitles(items []FeedItem) []string {
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Feed)
+	}
+	return titles
+}
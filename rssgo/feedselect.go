@@ -0,0 +1,165 @@
+// feedselect.go selects items by feed and category with substring, glob
+// or regular expression patterns
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pattern matches a name case-insensitively. "/expr/" is a regular
+// expression, text containing *, ? or [ a glob, anything else plain text.
+type pattern struct {
+	re   *regexp.Regexp
+	text string
+}
+
+// patternList matches when any of its patterns does
+type patternList []pattern
+
+// compilePatterns parses patterns given on the command line
+func compilePatterns(raw []string) (patternList, error) {
+	var list patternList
+	for _, r := range raw {
+		r = strings.TrimSpace(r)
+		switch {
+		case r == "":
+			continue
+		case len(r) > 2 && strings.HasPrefix(r, "/") && strings.HasSuffix(r, "/"):
+			re, err := regexp.Compile("(?i)" + r[1:len(r)-1])
+			if err != nil {
+				return nil, fmt.Errorf("pattern %s: %w", r, err)
+			}
+			list = append(list, pattern{re: re})
+		case strings.ContainsAny(r, "*?["):
+			re, err := compileGlob(r)
+			if err != nil {
+				return nil, fmt.Errorf("pattern %s: %w", r, err)
+			}
+			list = append(list, pattern{re: re})
+		default:
+			list = append(list, pattern{text: strings.ToLower(r)})
+		}
+	}
+	return list, nil
+}
+
+// errBadGlob reports a glob with an unterminated character class
+var errBadGlob = errors.New("unterminated [ in glob")
+
+// compileGlob turns a glob into an anchored, case-insensitive regular
+// expression. Unlike path.Match, * and ? also match "/", so *example.com*
+// selects feeds by any part of their URL.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, errBadGlob
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// match reports whether p matches s. Plain text matches a substring of s,
+// or with whole set only all of it.
+func (p pattern) match(s string, whole bool) bool {
+	switch {
+	case p.re != nil:
+		return p.re.MatchString(s)
+	case whole:
+		return strings.EqualFold(p.text, s)
+	}
+	return strings.Contains(strings.ToLower(s), p.text)
+}
+
+// matchFeed reports whether a pattern matches the feed's title or one of
+// its subscription URLs
+func (pl patternList) matchFeed(title string, urls []string) bool {
+	for _, p := range pl {
+		if p.match(title, false) {
+			return true
+		}
+		for _, u := range urls {
+			if p.match(u, false) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchAny reports whether a pattern matches one of names as a whole
+func (pl patternList) matchAny(names []string) bool {
+	for _, p := range pl {
+		for _, name := range names {
+			if p.match(name, true) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// feedURLs returns the subscription URLs of each feed title; the caller
+// must hold s.mu
+func (s *FeedStore) feedURLs() map[string][]string {
+	urls := make(map[string][]string)
+	for _, m := range s.meta {
+		urls[m.Title] = append(urls[m.Title], m.URL)
+	}
+	return urls
+}
+
+// groupItemsByFeed reorders items so each feed's items follow each other,
+// feeds in order of first appearance and items in their listing order
+func groupItemsByFeed(items []FeedItem) []FeedItem {
+	var feeds []string
+	byFeed := make(map[string][]FeedItem)
+	for _, item := range items {
+		if _, ok := byFeed[item.Feed]; !ok {
+			feeds = append(feeds, item.Feed)
+		}
+		byFeed[item.Feed] = append(byFeed[item.Feed], item)
+	}
+	grouped := make([]FeedItem, 0, len(items))
+	for _, feed := range feeds {
+		grouped = append(grouped, byFeed[feed]...)
+	}
+	return grouped
+}
+
+// spansFeeds reports whether items come from more than one feed
+func spansFeeds(items []FeedItem) bool {
+	for _, item := range items {
+		if item.Feed != items[0].Feed {
+			return true
+		}
+	}
+	return false
+}
+
+// isFeedURL reports whether a --feed value names a feed to fetch rather
+// than a pattern
+func isFeedURL(s string) bool {
+	return (strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")) && !strings.ContainsAny(s, "*?[")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestPatternMatchFeed(t *testing.T) {
+	const feedURL = "https://blog.example.com/feed.xml"
+	tests := []struct {
+		pattern string
+		title   string
+		want    bool
+	}{
+		{"go blog", "The Go Blog", true},
+		{"rust", "The Go Blog", false},
+		{"*example.com*", "Example", true},
+		{"*blog*", "Example", true},
+		{"https://*/feed.xml", "Example", true},
+		{"*.org/*", "Example", false},
+		{"the go ???g", "The Go Blog", true},
+		{"[tx]he*", "The Go Blog", true},
+		{"[!t]he*", "The Go Blog", false},
+		{"/a{1,3}/", "Baaa", true},
+		{"/^go/", "The Go Blog", false},
+		{"/BLOG\\.example/", "Example", true},
+	}
+	for _, tt := range tests {
+		list, err := compilePatterns([]string{tt.pattern})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if got := list.matchFeed(tt.title, []string{feedURL}); got != tt.want {
+			t.Errorf("%q on %q: match = %v, want %v", tt.pattern, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestPatternMatchAny(t *testing.T) {
+	tests := []struct {
+		pattern string
+		names   []string
+		want    bool
+	}{
+		{"security", []string{"Security"}, true},
+		{"security", []string{"security-news"}, false},
+		{"sponsor*", []string{"Sponsored"}, true},
+		{"sponsor*", []string{"not sponsored"}, false},
+		{"/^go(lang)?$/", []string{"rust", "golang"}, true},
+	}
+	for _, tt := range tests {
+		list, err := compilePatterns([]string{tt.pattern})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if got := list.matchAny(tt.names); got != tt.want {
+			t.Errorf("%q on %q: match = %v, want %v", tt.pattern, tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestCompilePatternsErrors(t *testing.T) {
+	for _, raw := range []string{"/a(/", "feed[", "[abc"} {
+		if _, err := compilePatterns([]string{raw}); err == nil {
+			t.Errorf("%q: no error", raw)
+		}
+	}
+}
+
+func TestFeedFlagKeepsCommas(t *testing.T) {
+	var cfg Config
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	registerListFlags(fs, &cfg)
+	if err := fs.Parse([]string{"-f", "/a{1,3}/", "--category", "a,b"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Feeds) != 1 || cfg.Feeds[0] != "/a{1,3}/" {
+		t.Errorf("Feeds = %q", cfg.Feeds)
+	}
+	if len(cfg.Categories) != 1 || cfg.Categories[0] != "a,b" {
+		t.Errorf("Categories = %q", cfg.Categories)
+	}
+}
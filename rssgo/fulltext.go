@@ -0,0 +1,94 @@
+// fulltext.go fetches the linked article for feeds that only publish a
+// teaser
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// articlesDir holds extracted articles, one file per link, next to the
+// item store
+const articlesDir = "articles"
+
+// maxArticleSize caps how much of an article page is read
+const maxArticleSize = 5 << 20
+
+// articleCachePath returns where the extracted article for link is kept
+func (f *Fetcher) articleCachePath(link string) string {
+	sum := sha256.Sum256([]byte(link))
+	return filepath.Join(filepath.Dir(f.store.path), articlesDir, hex.EncodeToString(sum[:])+".html")
+}
+
+// fullText returns the main content of the page at link, fetching and
+// extracting it only if it is not cached yet
+func (f *Fetcher) fullText(ctx context.Context, link string) (string, error) {
+	cachePath := f.articleCachePath(link)
+	if data, err := os.ReadFile(cachePath); err == nil {
+		return string(data), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "html") {
+		return "", fmt.Errorf("not an HTML page (%s)", ct)
+	}
+
+	body, err := newDecodedBody(resp)
+	if err != nil {
+		return "", err
+	}
+	article, err := extractArticle(io.LimitReader(body, maxArticleSize), resp.Request.URL)
+	if err != nil {
+		return "", err
+	}
+
+	// Write atomically
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return "", err
+	}
+	tmpPath := cachePath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(article), 0644); err != nil {
+		return "", err
+	}
+	return article, os.Rename(tmpPath, cachePath)
+}
+
+// fillFullText replaces the content of items not stored yet with their
+// full article. Items whose article cannot be extracted keep the content
+// the feed published.
+func (f *Fetcher) fillFullText(ctx context.Context, items []FeedItem) {
+	for i := range items {
+		item := &items[i]
+		if item.Link == "" || f.store.Has(item.ID) {
+			continue
+		}
+		article, err := f.fullText(ctx, item.Link)
+		if err != nil {
+			fmt.Fprintf(warnOutput, "full text of %s: %s\n", redact(item.Link), redact(err.Error()))
+			continue
+		}
+		item.Content = article
+	}
+}
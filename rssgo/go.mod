@@ -6,4 +6,7 @@ require (
 	github.com/peterbourgon/ff/v3 v3.4.0
 	github.com/spf13/pflag v1.0.5
 	golang.org/x/net v0.15.0
+	golang.org/x/term v0.12.0
 )
+
+require golang.org/x/sys v0.12.0 // indirect
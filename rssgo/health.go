@@ -0,0 +1,331 @@
+// health.go tracks fetch attempts per feed and reports feeds in trouble
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historyLimit is how many fetch attempts are kept per feed
+const historyLimit = 50
+
+// defaultDisableAfter is how long a feed may keep failing before it is
+// disabled
+const defaultDisableAfter = 14 * 24 * time.Hour
+
+// FetchAttempt records the outcome of one fetch of a feed
+type FetchAttempt struct {
+	Time    time.Time     `json:"time"`
+	Status  int           `json:"status,omitempty"` // HTTP status, 0 without a response
+	Latency time.Duration `json:"latency"`
+	New     int           `json:"new"` // items stored by this fetch
+	Error   string        `json:"error,omitempty"`
+}
+
+// Feed health levels, most severe first
+const (
+	healthDisabled = "disabled"
+	healthFailing  = "failing"
+	healthStale    = "stale"
+	healthOK       = "ok"
+)
+
+// healthSeverity orders health levels for the report
+var healthSeverity = map[string]int{
+	healthDisabled: 3,
+	healthFailing:  2,
+	healthStale:    1,
+	healthOK:       0,
+}
+
+// recordAttempt appends a to the feed's history and updates the failure
+// counters, disabling the feed once it has failed for disableAfter
+func recordAttempt(m *FeedMeta, a FetchAttempt, disableAfter time.Duration) {
+	m.History = append(m.History, a)
+	if len(m.History) > historyLimit {
+		m.History = m.History[len(m.History)-historyLimit:]
+	}
+
+	if a.Error == "" {
+		m.LastSuccess = a.Time
+		if a.New > 0 {
+			m.LastNewItems = a.Time
+		}
+		m.ConsecutiveFailures = 0
+		m.FailingSince = time.Time{}
+		return
+	}
+
+	m.ConsecutiveFailures++
+	if m.FailingSince.IsZero() {
+		m.FailingSince = a.Time
+	}
+	if disableAfter > 0 && !m.Dead && a.Time.Sub(m.FailingSince) >= disableAfter {
+		m.Dead = true
+		m.DeadSince = a.Time
+		m.DeadReason = fmt.Sprintf("failing since %s", m.FailingSince.Format("2006-01-02"))
+	}
+}
+
+// enableFeed resumes fetching a disabled feed, giving it a fresh start
+func enableFeed(m *FeedMeta) {
+	m.Dead = false
+	m.DeadSince = time.Time{}
+	m.DeadReason = ""
+	m.FailingSince = time.Time{}
+	m.ConsecutiveFailures = 0
+}
+
+// postingInterval returns the average gap between the publication dates
+// of items, or 0 if there are fewer than two
+func postingInterval(items []FeedItem) time.Duration {
+	if len(items) < 2 {
+		return 0
+	}
+	oldest, newest := items[0].Published, items[0].Published
+	for _, item := range items[1:] {
+		if item.Published.Before(oldest) {
+			oldest = item.Published
+		}
+		if item.Published.After(newest) {
+			newest = item.Published
+		}
+	}
+	return newest.Sub(oldest) / time.Duration(len(items)-1)
+}
+
+// feedHealth classifies m. A feed is stale when it fetches fine but has
+// brought nothing new for four times its usual posting interval, and at
+// least a week.
+func feedHealth(m FeedMeta, now time.Time) string {
+	switch {
+	case m.Dead:
+		return healthDisabled
+	case m.ConsecutiveFailures > 0:
+		return healthFailing
+	}
+	if m.PostingInterval > 0 && !m.LastNewItems.IsZero() {
+		quiet := 4 * m.PostingInterval
+		if quiet < 7*24*time.Hour {
+			quiet = 7 * 24 * time.Hour
+		}
+		if now.Sub(m.LastNewItems) > quiet {
+			return healthStale
+		}
+	}
+	return healthOK
+}
+
+// averageLatency returns the mean latency of the successful attempts in
+// history
+func averageLatency(history []FetchAttempt) time.Duration {
+	var total time.Duration
+	var n int
+	for _, a := range history {
+		if a.Error == "" {
+			total += a.Latency
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// formatAge returns how long ago t was in a short human form
+func formatAge(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return formatInterval(now.Sub(t)) + " ago"
+}
+
+// formatInterval returns d rounded to its largest sensible unit
+func formatInterval(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "-"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// cmdFeeds lists subscriptions, reports their health, re-enables one or
+// switches full-text fetching
+//
+//	rss feeds
+//	rss feeds health [<url>]
+//	rss feeds enable <url>
+//	rss feeds fulltext <url> [on|off]
+func cmdFeeds(cfg *Config, store *FeedStore, args []string) error {
+	if len(args) == 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "URL\tTITLE\tSTATUS")
+		for _, m := range store.Meta() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", redact(m.URL), m.Title, feedHealth(m, time.Now()))
+		}
+		return w.Flush()
+	}
+
+	switch args[0] {
+	case "health":
+		if len(args) == 2 {
+			return printFeedHistory(store, store.ResolveURL(args[1]))
+		}
+		if len(args) != 1 {
+			return usagef("usage: rss feeds health [<url>]")
+		}
+		return printHealthReport(store)
+	case "enable":
+		if len(args) != 2 {
+			return usagef("usage: rss feeds enable <url>")
+		}
+		url := store.ResolveURL(args[1])
+		if _, ok := store.MetaFor(url); !ok {
+			return fmt.Errorf("unknown feed %s", redact(url))
+		}
+		if err := store.UpdateMeta(url, enableFeed); err != nil {
+			return err
+		}
+		fmt.Printf("Enabled %s\n", redact(url))
+		return nil
+	case "fulltext":
+		return cmdFullText(store, args[1:])
+	default:
+		return usagef("unknown feeds command %q", args[0])
+	}
+}
+
+// printHealthReport prints every feed's health, most severe problems first
+func printHealthReport(store *FeedStore) error {
+	now := time.Now()
+	metas := store.Meta()
+	if len(metas) == 0 {
+		fmt.Println("No feeds fetched yet")
+		return nil
+	}
+
+	sort.SliceStable(metas, func(i, j int) bool {
+		si := healthSeverity[feedHealth(metas[i], now)]
+		sj := healthSeverity[feedHealth(metas[j], now)]
+		if si != sj {
+			return si > sj
+		}
+		if metas[i].ConsecutiveFailures != metas[j].ConsecutiveFailures {
+			return metas[i].ConsecutiveFailures > metas[j].ConsecutiveFailures
+		}
+		return metas[i].LastSuccess.Before(metas[j].LastSuccess)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HEALTH\tFEED\tLAST\tFAILS\tLAST SUCCESS\tLAST NEW\tLATENCY\tINTERVAL\tPROBLEM")
+	for _, m := range metas {
+		name := m.Title
+		if name == "" {
+			name = m.URL
+		}
+
+		last, problem := "-", m.DeadReason
+		if n := len(m.History); n > 0 {
+			a := m.History[n-1]
+			last = "error"
+			if a.Status != 0 {
+				last = fmt.Sprint(a.Status)
+			}
+			if a.Error != "" && problem == "" {
+				problem = a.Error
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			feedHealth(m, now),
+			truncate(redact(name), 40),
+			last,
+			m.ConsecutiveFailures,
+			formatAge(m.LastSuccess, now),
+			formatAge(m.LastNewItems, now),
+			averageLatency(m.History).Round(time.Millisecond),
+			formatInterval(m.PostingInterval),
+			truncate(problem, 60),
+		)
+	}
+	return w.Flush()
+}
+
+// printFeedHistory prints the recorded fetch attempts of one feed
+func printFeedHistory(store *FeedStore, url string) error {
+	m, ok := store.MetaFor(url)
+	if !ok {
+		return fmt.Errorf("unknown feed %s", redact(url))
+	}
+
+	fmt.Printf("%s\n%s\n", m.Title, redact(m.URL))
+	fmt.Printf("Health: %s", feedHealth(m, time.Now()))
+	if m.DeadReason != "" {
+		fmt.Printf(" (%s)", m.DeadReason)
+	}
+	fmt.Printf("\nPosting interval: %s\n\n", formatInterval(m.PostingInterval))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSTATUS\tLATENCY\tNEW\tERROR")
+	for i := len(m.History) - 1; i >= 0; i-- {
+		a := m.History[i]
+		status := "-"
+		if a.Status != 0 {
+			status = fmt.Sprint(a.Status)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+			a.Time.Format("2006-01-02 15:04:05"),
+			status,
+			a.Latency.Round(time.Millisecond),
+			a.New,
+			strings.TrimSpace(a.Error),
+		)
+	}
+	return w.Flush()
+}
+
+// cmdFullText shows or switches full-text fetching for one feed
+func cmdFullText(store *FeedStore, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usagef("usage: rss feeds fulltext <url> [on|off]")
+	}
+	url := store.ResolveURL(args[0])
+	m, ok := store.MetaFor(url)
+	if !ok {
+		return fmt.Errorf("unknown feed %s", redact(url))
+	}
+
+	on := m.FullText
+	if len(args) == 2 {
+		switch args[1] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			return usagef("usage: rss feeds fulltext <url> [on|off]")
+		}
+		if err := store.UpdateMeta(url, func(m *FeedMeta) { m.FullText = on }); err != nil {
+			return err
+		}
+	}
+
+	state := "off"
+	if on {
+		state = "on"
+	}
+	fmt.Printf("Full text for %s: %s\n", redact(url), state)
+	return nil
+}
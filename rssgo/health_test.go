@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRecordAttempt(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	steps := []struct {
+		at       time.Duration
+		err      string
+		newItems int
+		fails    int
+		dead     bool
+	}{
+		{0, "", 2, 0, false},
+		{day, "timeout", 0, 1, false},
+		{5 * day, "timeout", 0, 2, false},
+		{6 * day, "", 0, 0, false}, // a success resets the failure run
+		{7 * day, "404", 0, 1, false},
+		{20 * day, "404", 0, 2, false},
+		{21 * day, "404", 0, 3, true}, // failing for two weeks
+		{22 * day, "404", 0, 4, true},
+	}
+	var m FeedMeta
+	for _, s := range steps {
+		recordAttempt(&m, FetchAttempt{Time: start.Add(s.at), Error: s.err, New: s.newItems}, defaultDisableAfter)
+		if m.ConsecutiveFailures != s.fails || m.Dead != s.dead {
+			t.Fatalf("after day %d: failures %d, dead %v; want %d, %v",
+				s.at/day, m.ConsecutiveFailures, m.Dead, s.fails, s.dead)
+		}
+	}
+	if want := start.Add(21 * day); !m.DeadSince.Equal(want) {
+		t.Errorf("DeadSince = %v, want %v", m.DeadSince, want)
+	}
+	if want := start.Add(6 * day); !m.LastSuccess.Equal(want) || !m.LastNewItems.Equal(start) {
+		t.Errorf("LastSuccess %v, LastNewItems %v", m.LastSuccess, m.LastNewItems)
+	}
+	if m.DeadReason != "failing since 2024-03-08" {
+		t.Errorf("DeadReason = %q", m.DeadReason)
+	}
+
+	enableFeed(&m)
+	if m.Dead || m.ConsecutiveFailures != 0 || !m.FailingSince.IsZero() || m.DeadReason != "" {
+		t.Errorf("enabled feed = %+v", m)
+	}
+}
+
+func TestRecordAttemptNeverDisables(t *testing.T) {
+	var m FeedMeta
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		recordAttempt(&m, FetchAttempt{Time: start.Add(time.Duration(i) * 24 * time.Hour), Error: "down"}, 0)
+	}
+	if m.Dead {
+		t.Error("feed disabled with disableAfter 0")
+	}
+	if len(m.History) != historyLimit || !m.History[0].Time.Equal(start.Add(50*24*time.Hour)) {
+		t.Errorf("history holds %d attempts from %v, want the last %d", len(m.History), m.History[0].Time, historyLimit)
+	}
+}
+
+func TestFeedHealth(t *testing.T) {
+	now := time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		name string
+		m    FeedMeta
+		want string
+	}{
+		{"dead", FeedMeta{Dead: true, ConsecutiveFailures: 3}, healthDisabled},
+		{"failing", FeedMeta{ConsecutiveFailures: 1}, healthFailing},
+		{"new feed", FeedMeta{}, healthOK},
+		{"daily feed, quiet 3 days", FeedMeta{PostingInterval: day, LastNewItems: now.Add(-3 * day)}, healthOK},
+		{"daily feed, quiet 8 days", FeedMeta{PostingInterval: day, LastNewItems: now.Add(-8 * day)}, healthStale},
+		{"weekly feed, quiet 20 days", FeedMeta{PostingInterval: 7 * day, LastNewItems: now.Add(-20 * day)}, healthOK},
+		{"weekly feed, quiet 29 days", FeedMeta{PostingInterval: 7 * day, LastNewItems: now.Add(-29 * day)}, healthStale},
+	}
+	for _, tt := range tests {
+		if got := feedHealth(tt.m, now); got != tt.want {
+			t.Errorf("%s: feedHealth = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPostingInterval(t *testing.T) {
+	tests := []struct {
+		hours []int
+		want  time.Duration
+	}{
+		{nil, 0},
+		{[]int{5}, 0},
+		{[]int{1, 3}, 2 * time.Hour},
+		{[]int{10, 1, 4, 7}, 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		var items []FeedItem
+		for _, h := range tt.hours {
+			items = append(items, testItem("Feed", h))
+		}
+		if got := postingInterval(items); got != tt.want {
+			t.Errorf("postingInterval(hours %v) = %v, want %v", tt.hours, got, tt.want)
+		}
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                 "-",
+		42 * time.Second:  "42s",
+		45 * time.Minute:  "45m",
+		90 * time.Minute:  "1h",
+		47 * time.Hour:    "47h",
+		72 * time.Hour:    "3d",
+		-10 * time.Second: "-",
+	}
+	for d, want := range tests {
+		if got := formatInterval(d); got != want {
+			t.Errorf("formatInterval(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestAverageLatency(t *testing.T) {
+	history := []FetchAttempt{
+		{Latency: 100 * time.Millisecond},
+		{Latency: 5 * time.Second, Error: "timeout"},
+		{Latency: 300 * time.Millisecond},
+	}
+	if got := averageLatency(history); got != 200*time.Millisecond {
+		t.Errorf("averageLatency = %v, want 200ms", got)
+	}
+	if got := averageLatency(history[1:2]); got != 0 {
+		t.Errorf("averageLatency of failures only = %v, want 0", got)
+	}
+}
+
+func TestFeedsEnable(t *testing.T) {
+	store := newTestStore(t, 10)
+	const u = "https://down.test/feed.xml"
+	if err := store.UpdateMeta(u, func(m *FeedMeta) {
+		m.Dead, m.DeadReason, m.ConsecutiveFailures = true, "failing", 9
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	stdout := os.Stdout
+	os.Stdout = null
+	defer func() { os.Stdout = stdout }()
+
+	tests := []struct {
+		args  []string
+		usage bool
+		err   bool
+	}{
+		{[]string{"enable"}, true, true},
+		{[]string{"enable", "https://other.test/"}, false, true},
+		{[]string{"health", "a", "b"}, true, true},
+		{[]string{"fulltext", u, "maybe"}, true, true},
+		{[]string{"bogus"}, true, true},
+		{[]string{"enable", u}, false, false},
+	}
+	for _, tt := range tests {
+		err := cmdFeeds(nil, store, tt.args)
+		if (err != nil) != tt.err || (exitCode(err) == exitUsage) != tt.usage {
+			t.Errorf("feeds %v: err = %v", tt.args, err)
+		}
+	}
+	if m, _ := store.MetaFor(u); m.Dead || m.ConsecutiveFailures != 0 {
+		t.Errorf("after enable: %+v", m)
+	}
+}
@@ -0,0 +1,445 @@
+// htmltext.go renders the HTML found in feeds as readable text
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ANSI escape sequences used for styled text. The *Off codes end one
+// style without resetting the others, so styles can nest.
+const (
+	ansiItalic       = "\x1b[3m"
+	ansiUnderline    = "\x1b[4m"
+	ansiBoldOff      = "\x1b[22m" // also ends dim
+	ansiItalicOff    = "\x1b[23m"
+	ansiUnderlineOff = "\x1b[24m"
+)
+
+// textOptions controls renderText
+type textOptions struct {
+	Width int      // wrap lines at this many columns; 0 leaves them unwrapped
+	ANSI  bool     // style headings, emphasis and links for a terminal
+	Links bool     // number links and list their targets after the text
+	Base  *url.URL // resolves relative links
+}
+
+// cleanText returns the text of an HTML fragment on a single line, for
+// titles, authors and one-line summaries
+func cleanText(s string) string {
+	var b strings.Builder
+	var walkText func(n *html.Node)
+	walkText = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			return
+		case html.CommentNode:
+			b.WriteString(cdata(n))
+			return
+		case html.ElementNode:
+			if skippedText[n.DataAtom] {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walkText(c)
+		}
+		// Keep words in neighbouring blocks apart
+		if n.Type == html.ElementNode && !inlineTags[n.DataAtom] {
+			b.WriteByte(' ')
+		}
+	}
+	for _, n := range parseFragment(s) {
+		walkText(n)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// renderText lays out an HTML fragment as plain text with paragraph
+// breaks, indented lists and quotes, and optionally footnoted links
+func renderText(s string, opts textOptions) string {
+	r := &textRenderer{opts: opts, linkNumbers: make(map[string]int)}
+	for _, n := range parseFragment(s) {
+		r.render(n)
+	}
+	r.flush()
+
+	if len(r.links) > 0 {
+		r.out.WriteString("\n")
+		for i, link := range r.links {
+			r.out.WriteString("\n" + r.style(ansiDim, ansiBoldOff, fmt.Sprintf("[%d]", i+1)) + " " + link)
+		}
+	}
+	return r.out.String()
+}
+
+// parseFragment parses s as the content of a <body> element
+func parseFragment(s string) []*html.Node {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(s), body)
+	if err != nil {
+		return []*html.Node{{Type: html.TextNode, Data: s}}
+	}
+	return nodes
+}
+
+// cdata returns the content of a CDATA section, which the HTML parser
+// reads as a comment, or "" for a real comment
+func cdata(n *html.Node) string {
+	if !strings.HasPrefix(n.Data, "[CDATA[") {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(n.Data, "[CDATA["), "]]")
+}
+
+// skippedText are elements whose content is never shown
+var skippedText = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Head: true, atom.Template: true,
+	atom.Noscript: true, atom.Iframe: true, atom.Svg: true, atom.Object: true,
+}
+
+// inlineTags are elements that do not break the flow of text
+var inlineTags = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.B: true, atom.Bdi: true, atom.Bdo: true,
+	atom.Cite: true, atom.Code: true, atom.Data: true, atom.Del: true, atom.Dfn: true,
+	atom.Em: true, atom.Font: true, atom.I: true, atom.Ins: true, atom.Kbd: true,
+	atom.Mark: true, atom.Q: true, atom.S: true, atom.Samp: true, atom.Small: true,
+	atom.Span: true, atom.Strike: true, atom.Strong: true, atom.Sub: true, atom.Sup: true,
+	atom.Time: true, atom.Tt: true, atom.U: true, atom.Var: true, atom.Wbr: true,
+}
+
+// textRenderer accumulates the text of one fragment. Inline content
+// collects in line until a block boundary flushes it as a wrapped
+// paragraph.
+type textRenderer struct {
+	opts textOptions
+	out  strings.Builder
+	line strings.Builder
+
+	indent string // prefix of every output line
+	bullet string // prefix of the next line instead of indent, for list items
+	gap    bool   // a blank line is due before the next paragraph
+	pre    int    // depth of <pre> elements; text is kept verbatim inside
+	lists  int    // depth of lists
+
+	links       []string
+	linkNumbers map[string]int
+}
+
+// render adds n and everything below it
+func (r *textRenderer) render(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.line.WriteString(n.Data)
+		return
+	case html.CommentNode:
+		r.line.WriteString(cdata(n))
+		return
+	case html.ElementNode:
+	default:
+		r.children(n)
+		return
+	}
+	if skippedText[n.DataAtom] {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		if r.pre > 0 {
+			r.line.WriteString("\n")
+		} else {
+			r.flush()
+		}
+	case atom.Hr:
+		r.block(true)
+		r.line.WriteString("* * *")
+		r.block(true)
+	case atom.Img:
+		if alt, _ := attr(n, "alt"); strings.TrimSpace(alt) != "" {
+			r.line.WriteString(" [image: " + strings.TrimSpace(alt) + "] ")
+		}
+	case atom.P, atom.Figure, atom.Address, atom.Details, atom.Table:
+		r.block(true)
+		r.children(n)
+		r.block(true)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.block(true)
+		r.styled(n, ansiBold, ansiBoldOff)
+		r.block(true)
+	case atom.Pre:
+		r.block(true)
+		r.pre++
+		r.children(n)
+		r.flush()
+		r.pre--
+		r.block(true)
+	case atom.Blockquote:
+		r.block(true)
+		defer r.restoreIndent(r.indent)
+		r.indent += "> "
+		r.children(n)
+		r.block(true)
+	case atom.Ul, atom.Ol:
+		r.list(n)
+	case atom.Li:
+		// A stray item outside a list
+		r.item(n, "• ")
+	case atom.Dt:
+		r.block(false)
+		r.styled(n, ansiBold, ansiBoldOff)
+		r.block(false)
+	case atom.Dd:
+		r.block(false)
+		defer r.restoreIndent(r.indent)
+		r.indent += "    "
+		r.children(n)
+		r.block(false)
+	case atom.Tr:
+		r.block(false)
+		r.children(n)
+		r.block(false)
+	case atom.Td, atom.Th:
+		if previousElement(n) != nil {
+			r.line.WriteString(" | ")
+		}
+		if n.DataAtom == atom.Th {
+			r.styled(n, ansiBold, ansiBoldOff)
+		} else {
+			r.children(n)
+		}
+	case atom.B, atom.Strong:
+		r.styled(n, ansiBold, ansiBoldOff)
+	case atom.I, atom.Em, atom.Cite:
+		r.styled(n, ansiItalic, ansiItalicOff)
+	case atom.A:
+		r.link(n)
+	default:
+		if inlineTags[n.DataAtom] {
+			r.children(n)
+			return
+		}
+		r.block(false)
+		r.children(n)
+		r.block(false)
+	}
+}
+
+// children renders the children of n
+func (r *textRenderer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+}
+
+// styled renders the children of n between the on and off sequences
+func (r *textRenderer) styled(n *html.Node, on, off string) {
+	if r.opts.ANSI {
+		r.line.WriteString(on)
+	}
+	r.children(n)
+	if r.opts.ANSI {
+		r.line.WriteString(off)
+	}
+}
+
+// style wraps s in the on and off sequences when styling is enabled
+func (r *textRenderer) style(on, off, s string) string {
+	if !r.opts.ANSI {
+		return s
+	}
+	return on + s + off
+}
+
+// restoreIndent resets the indent when leaving a nested block
+func (r *textRenderer) restoreIndent(indent string) {
+	r.indent = indent
+}
+
+// list renders a <ul> or <ol>, numbering the items of the latter
+func (r *textRenderer) list(n *html.Node) {
+	// A list nested in an item follows it without a blank line
+	r.block(r.lists == 0)
+	r.lists++
+	number := 1
+	if start, ok := attr(n, "start"); ok {
+		if v, err := strconv.Atoi(start); err == nil {
+			number = v
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			r.render(c)
+			continue
+		}
+		marker := "• "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		r.item(c, marker)
+	}
+	r.lists--
+	r.block(r.lists == 0)
+}
+
+// item renders a list item, its first line starting with marker and the
+// rest aligned under its text
+func (r *textRenderer) item(n *html.Node, marker string) {
+	r.flush()
+	defer r.restoreIndent(r.indent)
+	r.bullet = r.indent + marker
+	r.indent += strings.Repeat(" ", len([]rune(marker)))
+	r.children(n)
+	r.flush()
+}
+
+// link renders an <a>, adding a footnote marker for its target
+func (r *textRenderer) link(n *html.Node) {
+	target := r.linkTarget(n)
+	if target == "" {
+		r.children(n)
+		return
+	}
+	r.styled(n, ansiUnderline, ansiUnderlineOff)
+	if strings.TrimSpace(nodeText(n)) == target {
+		return
+	}
+	num, ok := r.linkNumbers[target]
+	if !ok {
+		r.links = append(r.links, target)
+		num = len(r.links)
+		r.linkNumbers[target] = num
+	}
+	r.line.WriteString(r.style(ansiDim, ansiBoldOff, fmt.Sprintf("[%d]", num)))
+}
+
+// linkTarget returns the absolute target of a link worth footnoting, or ""
+func (r *textRenderer) linkTarget(n *html.Node) string {
+	if !r.opts.Links {
+		return ""
+	}
+	href, _ := attr(n, "href")
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if r.opts.Base != nil {
+		u = r.opts.Base.ResolveReference(u)
+	}
+	switch u.Scheme {
+	case "http", "https", "mailto":
+		return u.String()
+	}
+	return ""
+}
+
+// block ends the current paragraph; with gap the next one is separated
+// by a blank line
+func (r *textRenderer) block(gap bool) {
+	r.flush()
+	if gap {
+		r.gap = true
+	}
+}
+
+// flush writes the pending inline text as a paragraph
+func (r *textRenderer) flush() {
+	text := r.line.String()
+	r.line.Reset()
+
+	var lines []string
+	if r.pre > 0 {
+		lines = strings.Split(strings.Trim(text, "\n"), "\n")
+		if strings.TrimSpace(text) == "" {
+			lines = nil
+		}
+	} else {
+		width := 0
+		if r.opts.Width > 0 {
+			width = max(r.opts.Width-visibleWidth(r.indent), 20)
+		}
+		lines = wrapWords(strings.Fields(text), width)
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	if r.gap && r.out.Len() > 0 {
+		r.out.WriteString("\n")
+	}
+	r.gap = false
+	for i, line := range lines {
+		if r.out.Len() > 0 {
+			r.out.WriteString("\n")
+		}
+		prefix := r.indent
+		if i == 0 && r.bullet != "" {
+			prefix = r.bullet
+		}
+		r.out.WriteString(strings.TrimRight(prefix+line, " "))
+	}
+	r.bullet = ""
+}
+
+// wrapWords joins words into lines of at most width visible columns; a
+// width of 0 puts them all on one line
+func wrapWords(words []string, width int) []string {
+	if len(words) == 0 {
+		return nil
+	}
+	if width <= 0 {
+		return []string{strings.Join(words, " ")}
+	}
+
+	var lines []string
+	line, lineWidth := words[0], visibleWidth(words[0])
+	for _, w := range words[1:] {
+		ww := visibleWidth(w)
+		if lineWidth+1+ww > width {
+			lines = append(lines, line)
+			line, lineWidth = w, ww
+			continue
+		}
+		line += " " + w
+		lineWidth += 1 + ww
+	}
+	return append(lines, line)
+}
+
+// visibleWidth returns the number of runes in s, not counting ANSI escape
+// sequences
+func visibleWidth(s string) int {
+	n, esc := 0, false
+	for _, c := range s {
+		switch {
+		case esc:
+			esc = c != 'm'
+		case c == '\x1b':
+			esc = true
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// previousElement returns the element before n among its siblings
+func previousElement(n *html.Node) *html.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
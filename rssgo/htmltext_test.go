@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCleanText(t *testing.T) {
+	tests := map[string]string{
+		"":                                  "",
+		"Plain &amp; simple":                "Plain & simple",
+		"<b>Bold</b> and <i>italic</i>":     "Bold and italic",
+		"<p>One</p><p>Two</p>":              "One Two",
+		"line<br>break":                     "line break",
+		"  lots \n of\t space  ":            "lots of space",
+		"Keep <script>alert(1)</script>out": "Keep out",
+		"<![CDATA[raw text]]>":              "raw text",
+		"<!-- comment -->visible":           "visible",
+		"5 &lt; 6":                          "5 < 6",
+	}
+	for in, want := range tests {
+		if got := cleanText(in); got != want {
+			t.Errorf("cleanText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	base, _ := url.Parse("https://blog.test/posts/")
+	tests := []struct {
+		name string
+		in   string
+		opts textOptions
+		want string
+	}{
+		{"paragraphs", "<p>One</p><p>Two</p>", textOptions{}, "One\n\nTwo"},
+		{"wrapped", "<p>the quick brown fox jumps over the lazy dog</p>", textOptions{Width: 20},
+			"the quick brown fox\njumps over the lazy\ndog"},
+		{"bullets", "<ul><li>one</li><li>two</li></ul>", textOptions{}, "• one\n• two"},
+		{"numbered", `<ol start="3"><li>three</li><li>four</li></ol>`, textOptions{}, "3. three\n4. four"},
+		{"nested list", "<ul><li>a<ul><li>b</li></ul></li></ul>", textOptions{}, "• a\n  • b"},
+		{"quote", "<blockquote><p>said</p></blockquote>", textOptions{}, "> said"},
+		{"pre", "<pre>  keep\n    this</pre>", textOptions{}, "  keep\n    this"},
+		{"rule", "<p>a</p><hr><p>b</p>", textOptions{}, "a\n\n* * *\n\nb"},
+		{"image", `<p>see <img src="x.png" alt="a cat"> here</p>`, textOptions{}, "see [image: a cat] here"},
+		{"table", "<table><tr><th>k</th><th>v</th></tr><tr><td>a</td><td>1</td></tr></table>", textOptions{}, "k | v\na | 1"},
+		{"link without footnotes", `<a href="/x">text</a>`, textOptions{}, "text"},
+		{"footnoted links", `<p><a href="a">one</a> <a href="https://other.test/">two</a> <a href="a">again</a></p>`,
+			textOptions{Links: true, Base: base},
+			"one[1] two[2] again[1]\n\n[1] https://blog.test/posts/a\n[2] https://other.test/"},
+		{"bare link", `<a href="https://x.test/">https://x.test/</a>`, textOptions{Links: true}, "https://x.test/"},
+		{"fragment and script links", `<a href="#top">top</a> <a href="javascript:x()">js</a>`, textOptions{Links: true}, "top js"},
+		{"ansi", "<h1>Title</h1><p><em>it</em></p>", textOptions{ANSI: true}, ansiBold + "Title" + ansiBoldOff + "\n\n" + ansiItalic + "it" + ansiItalicOff},
+	}
+	for _, tt := range tests {
+		if got := renderText(tt.in, tt.opts); got != tt.want {
+			t.Errorf("%s: renderText(%q) =\n%q\nwant\n%q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWrapWords(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"", 10, nil},
+		{"one two three", 0, []string{"one two three"}},
+		{"one two three", 7, []string{"one two", "three"}},
+		{"unbreakablelongword x", 5, []string{"unbreakablelongword", "x"}},
+		{ansiBold + "bold" + ansiBoldOff + " word", 9, []string{ansiBold + "bold" + ansiBoldOff + " word"}},
+	}
+	for _, tt := range tests {
+		got := wrapWords(strings.Fields(tt.text), tt.width)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("wrapWords(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	tests := map[string]int{
+		"":                                     0,
+		"abc":                                  3,
+		"héllo":                                5,
+		ansiUnderline + "x" + ansiUnderlineOff: 1,
+	}
+	for s, want := range tests {
+		if got := visibleWidth(s); got != want {
+			t.Errorf("visibleWidth(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// httpclient.go builds the HTTP transport used by the fetcher
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// defaultUserAgent is sent when no --user-agent is configured
+const defaultUserAgent = "RSS-Reader/1.0"
+
+// newTransport returns the fetcher's default transport
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		// fetchFeed negotiates and decodes compression itself so it can
+		// count bytes on the wire
+		DisableCompression: true,
+	}
+}
+
+// configureTransport applies the proxy and TLS options in cfg to t
+func configureTransport(t *http.Transport, cfg *Config) (*http.Transport, error) {
+	switch cfg.Proxy {
+	case "":
+		// Keep http.ProxyFromEnvironment
+	case "none", "direct":
+		t.Proxy = nil
+	default:
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", redact(cfg.Proxy))
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if len(cfg.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range cfg.CACerts {
+			pem, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading CA certificate: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s: no PEM certificates found", path)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case cfg.ClientCert != "" && cfg.ClientKey != "":
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case cfg.ClientCert != "" || cfg.ClientKey != "":
+		return nil, fmt.Errorf("--client-cert and --client-key must be given together")
+	}
+
+	if cfg.InsecureSkipVerify {
+		fmt.Fprintln(warnOutput, "warning: TLS certificate verification is disabled")
+	}
+
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigureTransportProxy(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://feeds.test/rss", nil)
+	tests := []struct {
+		proxy string
+		want  string // proxy URL chosen for req, "" for a direct connection
+	}{
+		{"none", ""},
+		{"direct", ""},
+		{"http://proxy.test:3128", "http://proxy.test:3128"},
+		{"socks5://127.0.0.1:1080", "socks5://127.0.0.1:1080"},
+	}
+	for _, tt := range tests {
+		tr, err := configureTransport(newTransport(), &Config{Proxy: tt.proxy})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.proxy, err)
+		}
+		var got *url.URL
+		if tr.Proxy != nil {
+			got, _ = tr.Proxy(req)
+		}
+		if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+			t.Errorf("proxy %q: request goes via %v, want %q", tt.proxy, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureTransportErrors(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0644)
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"bad proxy", Config{Proxy: "proxy.test"}},
+		{"missing CA file", Config{CACerts: []string{filepath.Join(t.TempDir(), "missing.pem")}}},
+		{"CA file without certificates", Config{CACerts: []string{notPEM}}},
+		{"cert without key", Config{ClientCert: "client.pem"}},
+		{"key without cert", Config{ClientKey: "client.key"}},
+	}
+	for _, tt := range tests {
+		if _, err := configureTransport(newTransport(), &tt.cfg); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestFetchWithCACertAndUserAgent(t *testing.T) {
+	feed, err := os.ReadFile(filepath.Join("testdata", "feeds", "rss2.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var userAgent string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Write(feed)
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the CA the server's certificate is not trusted
+	fetcher := NewFetcher(newTestStore(t, 10))
+	if err := fetcher.Configure(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetcher.UpdateFeed(context.Background(), srv.URL); err == nil {
+		t.Error("untrusted certificate: no error")
+	}
+
+	fetcher = NewFetcher(newTestStore(t, 10))
+	if err := fetcher.Configure(&Config{CACerts: []string{caFile}, UserAgent: "test-agent/2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetcher.UpdateFeed(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if userAgent != "test-agent/2" {
+		t.Errorf("User-Agent = %q, want test-agent/2", userAgent)
+	}
+}
@@ -0,0 +1,206 @@
+// links.go normalises item links as they are stored: tracking parameters
+// are stripped and, optionally, redirector links are resolved
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// linksFile configures link normalisation
+const linksFile = "links.json"
+
+// defaultStripParams are query parameters removed from every link. A
+// trailing * matches any suffix.
+var defaultStripParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "msclkid", "yclid", "mc_cid", "mc_eid",
+	"igshid", "_hsenc", "_hsmi", "ref_src",
+}
+
+// defaultRedirectors are hosts that only redirect to the real article
+var defaultRedirectors = []string{
+	"feedproxy.google.com", "feeds.feedburner.com", "feedsportal.com",
+	"t.co", "bit.ly", "ow.ly", "buff.ly", "dlvr.it", "ift.tt", "lnkd.in", "trib.al",
+}
+
+// LinkRules configures how item links are normalised. StripParams and
+// Redirectors extend the defaults; KeepParams exempts parameters from
+// stripping.
+type LinkRules struct {
+	StripParams      []string `json:"strip_params,omitempty"`
+	KeepParams       []string `json:"keep_params,omitempty"`
+	ResolveRedirects bool     `json:"resolve_redirects,omitempty"` // HEAD links on Redirectors hosts
+	Redirectors      []string `json:"redirectors,omitempty"`
+
+	resolved sync.Map // link -> resolved link, for this run
+}
+
+// LoadLinkRules reads links.json from dir, using the defaults when it
+// does not exist
+func LoadLinkRules(dir string) (*LinkRules, error) {
+	path := filepath.Join(dir, linksFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &LinkRules{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules LinkRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+// matchParam reports whether name matches one of patterns
+func matchParam(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// stripParam reports whether the query parameter name is removed from
+// links
+func (lr *LinkRules) stripParam(name string) bool {
+	if matchParam(lr.KeepParams, name) {
+		return false
+	}
+	return matchParam(defaultStripParams, name) || matchParam(lr.StripParams, name)
+}
+
+// Clean removes blacklisted query parameters from link, keeping the order
+// of the others
+func (lr *LinkRules) Clean(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return link
+	}
+
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(name); err == nil && lr.stripParam(name) {
+			continue
+		}
+		if pair != "" {
+			kept = append(kept, pair)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String()
+}
+
+// isRedirector reports whether link points at a redirecting service
+func (lr *LinkRules) isRedirector(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for _, list := range [][]string{defaultRedirectors, lr.Redirectors} {
+		for _, r := range list {
+			r = strings.ToLower(r)
+			if host == r || strings.HasSuffix(host, "."+r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve follows the redirects of a redirector link with a HEAD request
+// and returns where they end, or link itself if that fails
+func (lr *LinkRules) resolve(ctx context.Context, client *http.Client, userAgent, link string) string {
+	if v, ok := lr.resolved.Load(link); ok {
+		return v.(string)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+	if err != nil {
+		return link
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(warnOutput, "resolving %s: %s\n", redact(link), redact(err.Error()))
+		return link
+	}
+	resp.Body.Close()
+
+	// Some servers refuse HEAD at the destination, but the redirects
+	// leading there still tell where the article is
+	final := resp.Request.URL.String()
+	lr.resolved.Store(link, final)
+	return final
+}
+
+// normalizeLinks cleans the links of items that are not stored yet
+func (f *Fetcher) normalizeLinks(ctx context.Context, items []FeedItem) {
+	for i := range items {
+		if !f.store.Has(items[i].ID) {
+			items[i].Link = f.normalizeLink(ctx, items[i].Link)
+		}
+	}
+}
+
+// normalizeLink cleans link, resolving redirectors first when enabled
+func (f *Fetcher) normalizeLink(ctx context.Context, link string) string {
+	if link == "" {
+		return ""
+	}
+	if f.links.ResolveRedirects && f.links.isRedirector(link) {
+		link = f.links.resolve(ctx, f.client, f.userAgent, link)
+	}
+	return f.links.Clean(link)
+}
+
+// resolveLink returns link made absolute against the chain of base URLs,
+// each relative to the one before; empty bases are skipped
+func resolveLink(link string, bases ...string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return ""
+	}
+	var base *url.URL
+	for _, b := range bases {
+		b = strings.TrimSpace(b)
+		if b == "" {
+			continue
+		}
+		u, err := url.Parse(b)
+		if err != nil {
+			continue
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		base = u
+	}
+	u, err := url.Parse(link)
+	if err != nil || base == nil || u.IsAbs() {
+		return link
+	}
+	return base.ResolveReference(u).String()
+}
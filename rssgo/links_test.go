@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLinkRulesClean(t *testing.T) {
+	lr := &LinkRules{StripParams: []string{"ref", "session_*"}, KeepParams: []string{"utm_id"}}
+	tests := map[string]string{
+		"https://a.test/post":                                  "https://a.test/post",
+		"https://a.test/post?utm_source=rss&utm_medium=feed":   "https://a.test/post",
+		"https://a.test/post?id=3&utm_source=rss&page=2":       "https://a.test/post?id=3&page=2",
+		"https://a.test/post?UTM_Campaign=x&fbclid=1#comments": "https://a.test/post#comments",
+		"https://a.test/post?ref=home&session_id=9&x=1":        "https://a.test/post?x=1",
+		"https://a.test/post?utm_id=42&utm_term=x":             "https://a.test/post?utm_id=42",
+		"https://a.test/post?b=2&a=1":                          "https://a.test/post?b=2&a=1",
+		"https://a.test/post?q=a%26b&gclid=z":                  "https://a.test/post?q=a%26b",
+		"https://a.test/post?":                                 "https://a.test/post?",
+		"not a url %zz":                                        "not a url %zz",
+	}
+	for in, want := range tests {
+		if got := lr.Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestIsRedirector(t *testing.T) {
+	lr := &LinkRules{Redirectors: []string{"go.example"}}
+	tests := map[string]bool{
+		"https://feeds.feedburner.com/~r/blog/1": true,
+		"https://t.co/abc":                       true,
+		"https://www.bit.ly/x":                   true,
+		"https://go.example/x":                   true,
+		"https://links.go.example/x":             true,
+		"https://notgo.example/x":                false,
+		"https://blog.test/t.co":                 false,
+	}
+	for link, want := range tests {
+		if got := lr.isRedirector(link); got != want {
+			t.Errorf("isRedirector(%q) = %v, want %v", link, got, want)
+		}
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	tests := []struct {
+		link  string
+		bases []string
+		want  string
+	}{
+		{"", []string{"https://a.test/"}, ""},
+		{"https://b.test/x", []string{"https://a.test/"}, "https://b.test/x"},
+		{"post/1", []string{"https://a.test/blog/"}, "https://a.test/blog/post/1"},
+		{"/post/1", []string{"https://a.test/blog/"}, "https://a.test/post/1"},
+		{"1.html", []string{"https://a.test/feed.xml", "posts/"}, "https://a.test/posts/1.html"},
+		{"1.html", []string{"", "https://a.test/posts/"}, "https://a.test/posts/1.html"},
+		{" post ", nil, "post"},
+	}
+	for _, tt := range tests {
+		if got := resolveLink(tt.link, tt.bases...); got != tt.want {
+			t.Errorf("resolveLink(%q, %q) = %q, want %q", tt.link, tt.bases, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeLinkResolvesRedirects(t *testing.T) {
+	var heads atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/r/1", func(w http.ResponseWriter, r *http.Request) {
+		heads.Add(1)
+		http.Redirect(w, r, "/post/1?utm_source=feedburner", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/post/1", func(w http.ResponseWriter, r *http.Request) {})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := NewFetcher(newTestStore(t, 10))
+	f.links = &LinkRules{ResolveRedirects: true, Redirectors: []string{"127.0.0.1"}}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if got, want := f.normalizeLink(ctx, srv.URL+"/r/1"), srv.URL+"/post/1"; got != want {
+			t.Errorf("normalizeLink = %q, want %q", got, want)
+		}
+	}
+	if n := heads.Load(); n != 1 {
+		t.Errorf("redirector asked %d times, want once per run", n)
+	}
+
+	f.links = &LinkRules{}
+	if got, want := f.normalizeLink(ctx, srv.URL+"/r/1?utm_source=x"), srv.URL+"/r/1"; got != want {
+		t.Errorf("without ResolveRedirects: normalizeLink = %q, want %q", got, want)
+	}
+}
+
+func TestLoadLinkRules(t *testing.T) {
+	dir := t.TempDir()
+	lr, err := LoadLinkRules(dir)
+	if err != nil || lr.ResolveRedirects || len(lr.StripParams) != 0 {
+		t.Fatalf("missing file: %+v, %v", lr, err)
+	}
+
+	path := filepath.Join(dir, linksFile)
+	if err := os.WriteFile(path, []byte(`{"strip_params": ["ref"], "resolve_redirects": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lr, err = LoadLinkRules(dir); err != nil || !lr.ResolveRedirects || lr.Clean("https://a.test/?ref=x") != "https://a.test/" {
+		t.Errorf("links.json: %+v, %v", lr, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"strip_params": "ref"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadLinkRules(dir); err == nil {
+		t.Error("malformed links.json: no error")
+	}
+}
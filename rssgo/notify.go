@@ -0,0 +1,593 @@
+// notify.go tells webhooks and local commands about newly fetched items
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// notifyFile is the name of the notification config in the data directory
+const notifyFile = "notify.json"
+
+// notifiedFile records which items each target was told about, so a
+// restart or a refetch of truncated items does not notify twice
+const notifiedFile = "notified.json"
+
+// notifyPendingFile lists the IDs of items that could not be delivered to
+// every target they match, so the next fetch retries them
+const notifyPendingFile = "notify_pending.json"
+
+// notifiedRetention is how long entries stay in the dedupe log
+const notifiedRetention = 90 * 24 * time.Hour
+
+// notifyTimeout bounds the deliveries after a fetch. They get their own
+// deadline because the fetch's may be all but spent by then.
+const notifyTimeout = 2 * time.Minute
+
+// defaultRetries is how often a failed delivery is retried
+const defaultRetries = 2
+
+// NotifyTarget is one destination for new-item notifications. Exactly one
+// of Webhook and Command must be set. Webhook and header values may be
+// written as "env:NAME" to keep secrets out of the file.
+type NotifyTarget struct {
+	Name string `json:"name"`
+
+	Webhook     string            `json:"webhook,omitempty"`      // URL the body is POSTed to
+	Headers     map[string]string `json:"headers,omitempty"`      // extra request headers
+	ContentType string            `json:"content_type,omitempty"` // defaults to application/json
+	Command     []string          `json:"command,omitempty"`      // program and arguments; the body is its stdin
+
+	// Filters; an item must pass every one that is set
+	Feed string   `json:"feed,omitempty"` // substring of the feed title, case-insensitive
+	Tags []string `json:"tags,omitempty"` // item carries at least one of these tags
+	Rule string   `json:"rule,omitempty"` // name of a rule in rules.json that matches the item
+
+	Template string `json:"template,omitempty"` // text/template for the body; default is the JSON payload
+	Batch    int    `json:"batch,omitempty"`    // most items per delivery, 0 for all at once
+	Retries  int    `json:"retries,omitempty"`  // retries after a failed delivery, -1 for none
+
+	tmpl *template.Template
+	rule *Rule
+}
+
+// Notifier delivers new items to the targets in the notification config
+type Notifier struct {
+	Targets []NotifyTarget `json:"targets"`
+
+	client      *http.Client
+	logPath     string
+	pendingPath string
+	mu          sync.Mutex // serialises deliveries and access to the dedupe log
+}
+
+// notification is the JSON payload of a delivery, and the data the body
+// template is executed with
+type notification struct {
+	Notifier string     `json:"notifier"`
+	Count    int        `json:"count"`
+	Items    []FeedItem `json:"items"`
+}
+
+// notifyFuncs are available in body templates
+var notifyFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": strings.Join,
+}
+
+// LoadNotifier reads the notification config from dir. A missing file
+// yields a nil Notifier, which sends nothing. Webhooks use transport.
+func LoadNotifier(dir string, transport http.RoundTripper) (*Notifier, error) {
+	path := filepath.Join(dir, notifyFile)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Notifier{
+		client:      &http.Client{Timeout: 30 * time.Second, Transport: transport},
+		logPath:     filepath.Join(dir, notifiedFile),
+		pendingPath: filepath.Join(dir, notifyPendingFile),
+	}
+	if err := json.Unmarshal(data, n); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	rules, err := LoadRules(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range n.Targets {
+		if err := n.Targets[i].compile(i, rules); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return n, nil
+}
+
+// compile validates the target, resolves its secrets and parses its template
+func (t *NotifyTarget) compile(i int, rules *RuleSet) error {
+	if t.Name == "" {
+		t.Name = fmt.Sprintf("target %d", i+1)
+	}
+	if (t.Webhook == "") == (len(t.Command) == 0) {
+		return fmt.Errorf("%s: set exactly one of webhook and command", t.Name)
+	}
+
+	var err error
+	if t.Webhook, err = expandEnv(t.Webhook); err != nil {
+		return fmt.Errorf("%s: %w", t.Name, err)
+	}
+	registerWebhookSecrets(t.Webhook)
+	for k, v := range t.Headers {
+		if t.Headers[k], err = expandEnv(v); err != nil {
+			return fmt.Errorf("%s: %w", t.Name, err)
+		}
+		registerSecret(t.Headers[k])
+	}
+
+	if t.Template != "" {
+		t.tmpl, err = template.New(t.Name).Funcs(notifyFuncs).Parse(t.Template)
+		if err != nil {
+			return fmt.Errorf("%s: template: %w", t.Name, err)
+		}
+	}
+
+	if t.Rule != "" {
+		for j := range rules.Rules {
+			if rules.Rules[j].Name == t.Rule {
+				t.rule = &rules.Rules[j]
+			}
+		}
+		if t.rule == nil {
+			return fmt.Errorf("%s: unknown rule %q", t.Name, t.Rule)
+		}
+	}
+	return nil
+}
+
+// registerWebhookSecrets registers the parts of a webhook URL that carry
+// credentials, its userinfo and token-like query values, so the rest of
+// the URL stays readable in rss notify and in errors
+func registerWebhookSecrets(raw string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		registerSecret(raw)
+		return
+	}
+	if u.User != nil {
+		registerSecret(u.User.Username())
+		if password, ok := u.User.Password(); ok {
+			registerSecret(password)
+		}
+	}
+	for name, values := range u.Query() {
+		if !secretParam(name) {
+			continue
+		}
+		for _, v := range values {
+			registerSecret(v)
+		}
+	}
+}
+
+// secretParam reports whether a query parameter name suggests a credential
+func secretParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"token", "key", "secret", "sig", "auth", "pass", "code"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether item passes the target's filters
+func (t *NotifyTarget) match(item *FeedItem) bool {
+	if t.Feed != "" && !containsFold(item.Feed, t.Feed) {
+		return false
+	}
+	if len(t.Tags) > 0 {
+		found := false
+		for _, tag := range t.Tags {
+			if hasFold(item.Tags, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if t.rule != nil && !t.rule.Match(item) {
+		return false
+	}
+	return true
+}
+
+// body renders the delivery body for items
+func (t *NotifyTarget) body(items []FeedItem) ([]byte, error) {
+	payload := notification{Notifier: t.Name, Count: len(items), Items: items}
+	if t.tmpl == nil {
+		return json.MarshalIndent(payload, "", "  ")
+	}
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Send delivers items to every target whose filters they pass, in
+// batches, skipping items a target was already told about. Failed
+// deliveries are reported but do not stop the others; their items are
+// recorded as pending for the next Send.
+func (n *Notifier) Send(ctx context.Context, items []FeedItem) error {
+	if n == nil || len(items) == 0 {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.send(ctx, items)
+}
+
+// SendWithPending is Send for items together with the items an earlier
+// Send failed to deliver, which lookup finds by ID. Pending items lookup
+// no longer finds are dropped. The pending list is read and replaced
+// under the same lock as the deliveries.
+func (n *Notifier) SendWithPending(ctx context.Context, items []FeedItem, lookup func(id string) (FeedItem, bool)) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	pending, err := n.loadPending()
+	if err != nil {
+		return err
+	}
+	for _, id := range pending {
+		if slices.ContainsFunc(items, func(item FeedItem) bool { return item.ID == id }) {
+			continue
+		}
+		if item, ok := lookup(id); ok {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		if len(pending) > 0 {
+			return n.savePending(nil)
+		}
+		return nil
+	}
+	return n.send(ctx, items)
+}
+
+// send delivers items as described for Send; the caller must hold n.mu
+func (n *Notifier) send(ctx context.Context, items []FeedItem) error {
+	sentLog, err := n.loadLog()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var undelivered []string
+	for i := range n.Targets {
+		t := &n.Targets[i]
+		sent := sentLog[t.Name]
+		if sent == nil {
+			sent = make(map[string]time.Time)
+			sentLog[t.Name] = sent
+		}
+
+		var pending []FeedItem
+		for _, item := range items {
+			if _, ok := sent[item.ID]; !ok && t.match(&item) {
+				pending = append(pending, item)
+			}
+		}
+
+		for len(pending) > 0 {
+			batch := pending
+			if t.Batch > 0 && len(batch) > t.Batch {
+				batch = batch[:t.Batch]
+			}
+			pending = pending[len(batch):]
+
+			if err := n.deliver(ctx, t, batch); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+				for _, item := range batch {
+					undelivered = append(undelivered, item.ID)
+				}
+				continue
+			}
+			now := time.Now()
+			for _, item := range batch {
+				sent[item.ID] = now
+			}
+		}
+	}
+
+	if err := n.saveLog(sentLog); err != nil {
+		errs = append(errs, err)
+	}
+	if err := n.savePending(undelivered); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Pending returns the IDs of items whose delivery failed in the last Send
+func (n *Notifier) Pending() ([]string, error) {
+	if n == nil {
+		return nil, nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.loadPending()
+}
+
+// loadPending reads the pending list; the caller must hold n.mu
+func (n *Notifier) loadPending() ([]string, error) {
+	var ids []string
+	data, err := os.ReadFile(n.pendingPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("%s: %w", n.pendingPath, err)
+	}
+	return ids, nil
+}
+
+// savePending replaces the pending list with ids, removing the file when
+// everything was delivered
+func (n *Notifier) savePending(ids []string) error {
+	if len(ids) == 0 {
+		if err := os.Remove(n.pendingPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sort.Strings(ids)
+	ids = slices.Compact(ids)
+
+	data, err := json.MarshalIndent(ids, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := n.pendingPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, n.pendingPath)
+}
+
+// deliver sends one batch to t, retrying with exponential backoff
+func (n *Notifier) deliver(ctx context.Context, t *NotifyTarget, items []FeedItem) error {
+	body, err := t.body(items)
+	if err != nil {
+		return err
+	}
+
+	retries := t.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if t.Webhook != "" {
+			retry, err = n.post(ctx, t, body)
+		} else {
+			retry, err = runNotifyCommand(ctx, t, body, len(items))
+		}
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// post sends body to the target's webhook. It reports whether a failure
+// is worth retrying.
+func (n *Notifier) post(ctx context.Context, t *NotifyTarget, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	contentType := t.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", defaultUserAgent)
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook answered %s", resp.Status)
+}
+
+// runNotifyCommand runs the target's command with body on stdin. Failures
+// are always worth retrying.
+func runNotifyCommand(ctx context.Context, t *NotifyTarget, body []byte, count int) (bool, error) {
+	cmd := exec.CommandContext(ctx, t.Command[0], t.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"RSS_NOTIFIER="+t.Name,
+		fmt.Sprintf("RSS_ITEM_COUNT=%d", count),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return true, fmt.Errorf("%s: %w: %s", t.Command[0], err, truncate(msg, 200))
+		}
+		return true, fmt.Errorf("%s: %w", t.Command[0], err)
+	}
+	return false, nil
+}
+
+// loadLog reads the dedupe log: target name to item ID to delivery time
+func (n *Notifier) loadLog() (map[string]map[string]time.Time, error) {
+	sentLog := make(map[string]map[string]time.Time)
+	data, err := os.ReadFile(n.logPath)
+	if os.IsNotExist(err) {
+		return sentLog, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &sentLog); err != nil {
+		return nil, fmt.Errorf("%s: %w", n.logPath, err)
+	}
+	return sentLog, nil
+}
+
+// saveLog writes the dedupe log, dropping entries past notifiedRetention
+func (n *Notifier) saveLog(sentLog map[string]map[string]time.Time) error {
+	cutoff := time.Now().Add(-notifiedRetention)
+	for _, sent := range sentLog {
+		for id, at := range sent {
+			if at.Before(cutoff) {
+				delete(sent, id)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(sentLog, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write atomically
+	tmpPath := n.logPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, n.logPath)
+}
+
+// notify hands the items added since the last call to the notifier,
+// together with the items an earlier call failed to deliver. Deliveries
+// keep ctx's values but not its deadline; they get notifyTimeout.
+func (f *Fetcher) notify(ctx context.Context) {
+	f.mu.Lock()
+	fresh := f.fresh
+	f.fresh = nil
+	f.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+
+	lookup := func(id string) (FeedItem, bool) {
+		item, err := f.store.Find(id)
+		return item, err == nil && item.ID == id
+	}
+	if err := f.notifier.SendWithPending(ctx, fresh, lookup); err != nil {
+		fmt.Fprintf(warnOutput, "notify: %s\n", redact(err.Error()))
+	}
+}
+
+// cmdNotify lists the notification targets, or with "test <name>" sends
+// the newest stored item to one of them without recording it
+func cmdNotify(cfg *Config, store *FeedStore, args []string) error {
+	if len(args) != 0 && (len(args) != 2 || args[0] != "test") {
+		return usagef("usage: rss notify [test <name>]")
+	}
+	fetcher, err := newConfiguredFetcher(cfg, store)
+	if err != nil {
+		return err
+	}
+	n := fetcher.notifier
+	if n == nil || len(n.Targets) == 0 {
+		fmt.Printf("No notification targets in %s\n", filepath.Join(cfg.DataDir, notifyFile))
+		return nil
+	}
+
+	if len(args) == 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tDESTINATION\tFILTERS")
+		for _, t := range n.Targets {
+			dest := redact(t.Webhook)
+			if dest == "" {
+				dest = strings.Join(t.Command, " ")
+			}
+			var filters []string
+			if t.Feed != "" {
+				filters = append(filters, "feed~"+t.Feed)
+			}
+			for _, tag := range t.Tags {
+				filters = append(filters, "#"+tag)
+			}
+			if t.Rule != "" {
+				filters = append(filters, "rule="+t.Rule)
+			}
+			if len(filters) == 0 {
+				filters = append(filters, "all items")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", t.Name, dest, strings.Join(filters, " "))
+		}
+		return w.Flush()
+	}
+
+	items := store.ListWith(ListOptions{Limit: 1, Reverse: true})
+	if len(items) == 0 {
+		return fmt.Errorf("no stored items to send")
+	}
+	for i := range n.Targets {
+		if n.Targets[i].Name == args[1] {
+			if err := n.deliver(context.Background(), &n.Targets[i], items); err != nil {
+				return err
+			}
+			fmt.Printf("Sent %q to %s\n", items[0].Title, args[1])
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown notification target %q", args[1])
+}
@@ -0,0 +1,132 @@
+// paging.go orders listings and splits them into pages
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sort keys accepted by ListOptions.Sort
+const (
+	sortPublished = "published"
+	sortAdded     = "added"
+	sortFeed      = "feed"
+	sortTitle     = "title"
+)
+
+// sortKeys lists the sort keys for help and errors
+var sortKeys = []string{sortPublished, sortAdded, sortFeed, sortTitle}
+
+// ItemPage is one page of a listing
+type ItemPage struct {
+	Items []FeedItem
+	Total int    // matching items before pagination
+	Next  string // cursor for the following page, "" on the last one
+}
+
+// checkSortKey returns an error for an unknown sort key; "" means
+// published
+func checkSortKey(key string) error {
+	if key == "" || contains(sortKeys, key) {
+		return nil
+	}
+	return fmt.Errorf("unknown sort key %q (want %s)", key, strings.Join(sortKeys, ", "))
+}
+
+// timeSort reports whether key orders items by a date, where "the newest
+// N" is meaningful
+func timeSort(key string) bool {
+	return key == "" || key == sortPublished || key == sortAdded
+}
+
+// itemLess orders items ascending by key. Ties fall back to the
+// publication date and finally the ID, so the order is total and cursors
+// stay stable.
+func itemLess(key string) func(a, b *FeedItem) bool {
+	return func(a, b *FeedItem) bool {
+		switch key {
+		case sortAdded:
+			if !a.Added.Equal(b.Added) {
+				return a.Added.Before(b.Added)
+			}
+		case sortFeed:
+			if c := strings.Compare(strings.ToLower(a.Feed), strings.ToLower(b.Feed)); c != 0 {
+				return c < 0
+			}
+		case sortTitle:
+			if c := strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)); c != 0 {
+				return c < 0
+			}
+		}
+		if !a.Published.Equal(b.Published) {
+			return a.Published.Before(b.Published)
+		}
+		return a.ID < b.ID
+	}
+}
+
+// Page returns the items selected by opts together with the total number
+// that matched and a cursor for the next page
+func (s *FeedStore) Page(opts ListOptions) ItemPage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	opts.feedURLs = s.feedURLs()
+	var items []FeedItem
+	for i := range s.items {
+		if opts.Match(&s.items[i]) {
+			items = append(items, s.items[i])
+		}
+	}
+	if opts.Collapse {
+		items = s.collapseClusters(items)
+	}
+
+	less := itemLess(opts.Sort)
+	before := less
+	if opts.Reverse {
+		before = func(a, b *FeedItem) bool { return less(b, a) }
+	}
+	sort.Slice(items, func(i, j int) bool { return before(&items[i], &items[j]) })
+
+	// The cursor is the ID of the item a page ended at. It is located by
+	// its sort position, so it still works if the item itself no longer
+	// matches the filters.
+	start, end := 0, len(items)
+	if opts.Cursor != "" {
+		i, err := s.find(opts.Cursor)
+		if err != nil {
+			return ItemPage{Total: len(items)}
+		}
+		cursor := s.items[i]
+		if opts.Tail {
+			end = sort.Search(len(items), func(k int) bool { return !before(&items[k], &cursor) })
+		} else {
+			start = sort.Search(len(items), func(k int) bool { return before(&cursor, &items[k]) })
+		}
+	}
+
+	// Tail pages count back from the end of the order
+	if opts.Tail {
+		end = max(start, end-opts.Offset)
+		if opts.Limit > 0 {
+			start = max(start, end-opts.Limit)
+		}
+	} else {
+		start = min(end, start+opts.Offset)
+		if opts.Limit > 0 {
+			end = min(end, start+opts.Limit)
+		}
+	}
+
+	page := ItemPage{Items: items[start:end], Total: len(items)}
+	switch {
+	case start == end:
+	case opts.Tail && start > 0:
+		page.Next = items[start].ID
+	case !opts.Tail && end < len(items):
+		page.Next = items[end-1].ID
+	}
+	return page
+}
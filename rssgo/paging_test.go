@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagingStore holds six items: A at hours 1, 3 and 5, b at 2 and 4, and
+// C at 6, added in reverse order of publication
+func pagingStore(t *testing.T) *FeedStore {
+	t.Helper()
+	store := newTestStore(t, 100)
+	var items []FeedItem
+	for i, f := range []string{"A", "b", "A", "b", "A", "C"} {
+		item := testItem(f, i+1)
+		item.Added = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(i) * time.Hour)
+		items = append(items, item)
+	}
+	if _, err := store.Add(items); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestPageSort(t *testing.T) {
+	store := pagingStore(t)
+	tests := []struct {
+		opts ListOptions
+		want string
+	}{
+		{ListOptions{}, "A-1 b-2 A-3 b-4 A-5 C-6"},
+		{ListOptions{Sort: sortPublished, Reverse: true}, "C-6 A-5 b-4 A-3 b-2 A-1"},
+		{ListOptions{Sort: sortAdded}, "C-6 A-5 b-4 A-3 b-2 A-1"},
+		{ListOptions{Sort: sortFeed}, "A-1 A-3 A-5 b-2 b-4 C-6"},
+		{ListOptions{Sort: sortFeed, Reverse: true}, "C-6 b-4 b-2 A-5 A-3 A-1"},
+		{ListOptions{Sort: sortTitle, Feed: "A"}, "A-1 A-3 A-5"},
+	}
+	for _, tt := range tests {
+		page := store.Page(tt.opts)
+		if got := strings.Join(ids(page.Items), " "); got != tt.want || page.Total != len(page.Items) {
+			t.Errorf("Page(sort %q, reverse %v) = %s (total %d), want %s", tt.opts.Sort, tt.opts.Reverse, got, page.Total, tt.want)
+		}
+	}
+}
+
+func TestPageOffsetLimit(t *testing.T) {
+	store := pagingStore(t)
+	tests := []struct {
+		opts ListOptions
+		want string
+		next string
+	}{
+		{ListOptions{Limit: 2}, "A-1 b-2", "b-2"},
+		{ListOptions{Limit: 2, Offset: 2}, "A-3 b-4", "b-4"},
+		{ListOptions{Limit: 2, Offset: 4}, "A-5 C-6", ""},
+		{ListOptions{Offset: 10}, "", ""},
+		{ListOptions{Limit: 2, Tail: true}, "A-5 C-6", "A-5"},
+		{ListOptions{Limit: 2, Offset: 1, Tail: true}, "b-4 A-5", "b-4"},
+		{ListOptions{Limit: 10, Tail: true}, "A-1 b-2 A-3 b-4 A-5 C-6", ""},
+	}
+	for _, tt := range tests {
+		page := store.Page(tt.opts)
+		got := strings.Join(ids(page.Items), " ")
+		if got != tt.want || page.Next != tt.next || page.Total != 6 {
+			t.Errorf("Page(%+v) = %q next %q total %d, want %q next %q total 6",
+				tt.opts, got, page.Next, page.Total, tt.want, tt.next)
+		}
+	}
+}
+
+func TestPageCursorWalk(t *testing.T) {
+	for _, tail := range []bool{false, true} {
+		store := pagingStore(t)
+		var pages []string
+		opts := ListOptions{Limit: 4, Tail: tail, Sort: sortFeed}
+		for {
+			page := store.Page(opts)
+			pages = append(pages, strings.Join(ids(page.Items), " "))
+			if page.Next == "" {
+				break
+			}
+			// An item arriving between pages does not shift the next one
+			if _, err := store.Add([]FeedItem{testItem("A", 10+len(pages))}); err != nil {
+				t.Fatal(err)
+			}
+			opts.Cursor = page.Next
+		}
+
+		want := "A-1 A-3 A-5 b-2|b-4 C-6"
+		if tail {
+			want = "A-5 b-2 b-4 C-6|A-1 A-3"
+		}
+		if got := strings.Join(pages, "|"); got != want {
+			t.Errorf("tail %v: pages %q, want %q", tail, got, want)
+		}
+	}
+}
+
+func TestPageUnknownCursor(t *testing.T) {
+	page := pagingStore(t).Page(ListOptions{Cursor: "gone-1"})
+	if len(page.Items) != 0 || page.Total != 6 {
+		t.Errorf("unknown cursor: %v total %d", ids(page.Items), page.Total)
+	}
+}
+
+func TestCheckSortKey(t *testing.T) {
+	for _, key := range append([]string{""}, sortKeys...) {
+		if err := checkSortKey(key); err != nil {
+			t.Errorf("checkSortKey(%q): %v", key, err)
+		}
+	}
+	if err := checkSortKey("colour"); err == nil || !strings.Contains(err.Error(), "published") {
+		t.Errorf("checkSortKey(colour) = %v", err)
+	}
+}
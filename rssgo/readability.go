@@ -0,0 +1,286 @@
+// readability.go extracts the main article from a web page
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// errNoArticle is returned when a page has no recognisable main content
+var errNoArticle = errors.New("no article content found")
+
+var (
+	// Class and id values that mark page chrome rather than content
+	unlikelyRe = regexp.MustCompile(`(?i)comment|sidebar|footer|header|menu|nav|share|social|related|promo|banner|advert|\bads?\b|cookie|subscribe|newsletter|popup|breadcrumb|pagination`)
+	// Class and id values that mark the article itself
+	likelyRe = regexp.MustCompile(`(?i)article|body|content|entry|main|post|story|text|blog`)
+)
+
+// removedTags are dropped from the page with everything inside them
+var removedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true,
+	atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+	atom.Iframe: true, atom.Svg: true, atom.Button: true, atom.Select: true,
+	atom.Input: true, atom.Textarea: true,
+}
+
+// keptTags survive cleaning, with the listed attributes; other elements
+// are replaced by their children
+var keptTags = map[atom.Atom][]string{
+	atom.P: nil, atom.Br: nil, atom.Hr: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Ul: nil, atom.Ol: nil, atom.Li: nil, atom.Dl: nil, atom.Dt: nil, atom.Dd: nil,
+	atom.Blockquote: nil, atom.Pre: nil, atom.Code: nil,
+	atom.Em: nil, atom.Strong: nil, atom.B: nil, atom.I: nil, atom.Sub: nil, atom.Sup: nil,
+	atom.A: {"href"}, atom.Img: {"src", "alt"},
+	atom.Figure: nil, atom.Figcaption: nil,
+	atom.Table: nil, atom.Thead: nil, atom.Tbody: nil, atom.Tr: nil, atom.Th: nil, atom.Td: nil,
+}
+
+// extractArticle returns the cleaned HTML of the main content of the page
+// in r, with links and images made absolute against base. It scores
+// block elements by the paragraphs they contain, in the manner of
+// Readability, and keeps the best one together with similarly scored
+// siblings.
+func extractArticle(r io.Reader, base *url.URL) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	prune(doc)
+
+	scores := make(map[*html.Node]float64)
+	walk(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode || (n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td) {
+			return
+		}
+		text := nodeText(n)
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		if parent := n.Parent; parent != nil {
+			scores[parent] += score
+			if grand := parent.Parent; grand != nil {
+				scores[grand] += score / 2
+			}
+		}
+	})
+
+	var top *html.Node
+	var topScore float64
+	for n, score := range scores {
+		score = (score + classWeight(n)) * (1 - linkDensity(n))
+		scores[n] = score
+		if top == nil || score > topScore {
+			top, topScore = n, score
+		}
+	}
+	if top == nil || top.DataAtom == atom.Body || top.DataAtom == atom.Html {
+		// Prefer an explicit <article> over the whole body
+		if article := findElement(doc, atom.Article); article != nil {
+			top = article
+		}
+	}
+	if top == nil {
+		return "", errNoArticle
+	}
+
+	// Siblings that scored nearly as well belong to the article too
+	threshold := max(10, topScore*0.2)
+	var parts []*html.Node
+	if top.Parent != nil {
+		for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+			if s == top || (s.Type == html.ElementNode && scores[s] >= threshold) {
+				parts = append(parts, s)
+			}
+		}
+	} else {
+		parts = []*html.Node{top}
+	}
+
+	var buf bytes.Buffer
+	for _, part := range parts {
+		for _, n := range cleanNode(part, base) {
+			if err := html.Render(&buf, n); err != nil {
+				return "", err
+			}
+		}
+	}
+	out := strings.TrimSpace(buf.String())
+	if len(strings.TrimSpace(cleanText(out))) < 80 {
+		return "", errNoArticle
+	}
+	return out, nil
+}
+
+// prune removes page chrome: removedTags, hidden elements and elements
+// whose class or id marks them as unlikely content
+func prune(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && unlikely(c)) {
+			n.RemoveChild(c)
+		} else {
+			prune(c)
+		}
+		c = next
+	}
+}
+
+// unlikely reports whether element n is not part of the main content
+func unlikely(n *html.Node) bool {
+	if removedTags[n.DataAtom] {
+		return true
+	}
+	if _, hidden := attr(n, "hidden"); hidden {
+		return true
+	}
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Html || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	id, _ := attr(n, "id")
+	class, _ := attr(n, "class")
+	names := id + " " + class
+	return unlikelyRe.MatchString(names) && !likelyRe.MatchString(names)
+}
+
+// classWeight favours elements whose class or id suggest content
+func classWeight(n *html.Node) float64 {
+	id, _ := attr(n, "id")
+	class, _ := attr(n, "class")
+	var w float64
+	for _, v := range []string{id, class} {
+		if v == "" {
+			continue
+		}
+		if likelyRe.MatchString(v) {
+			w += 25
+		}
+		if unlikelyRe.MatchString(v) {
+			w -= 25
+		}
+	}
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		w += 25
+	}
+	return w
+}
+
+// linkDensity returns the share of n's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	var links int
+	walk(n, func(c *html.Node) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			links += len(nodeText(c))
+		}
+	})
+	return float64(links) / float64(total)
+}
+
+// cleanNode returns a copy of n reduced to keptTags and their allowed
+// attributes, with URLs resolved against base. Unknown elements are
+// replaced by their cleaned children.
+func cleanNode(n *html.Node, base *url.URL) []*html.Node {
+	switch n.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: n.Data}}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, cleanNode(c, base)...)
+	}
+
+	allowed, ok := keptTags[n.DataAtom]
+	if !ok {
+		return children
+	}
+
+	out := &html.Node{Type: html.ElementNode, Data: n.Data, DataAtom: n.DataAtom}
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !contains(allowed, a.Key) {
+			continue
+		}
+		if a.Key == "href" || a.Key == "src" {
+			u, err := base.Parse(strings.TrimSpace(a.Val))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			a.Val = u.String()
+		}
+		out.Attr = append(out.Attr, a)
+	}
+	if n.DataAtom == atom.Img && len(out.Attr) == 0 {
+		return nil
+	}
+	for _, c := range children {
+		out.AppendChild(c)
+	}
+	return []*html.Node{out}
+}
+
+// walk calls fn for n and every node below it
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// findElement returns the first element of type a below n
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) {
+		if found == nil && c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+		}
+	})
+	return found
+}
+
+// nodeText returns the text below n with whitespace collapsed
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+			b.WriteByte(' ')
+		}
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// attr returns the value of n's attribute key
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// articlePage is a blog post surrounded by the usual page chrome
+const articlePage = `<!DOCTYPE html>
+<html><head><title>Post</title><script>var tracking = 1;</script></head>
+<body>
+<header><a href="/">Home</a> <a href="/about">About</a></header>
+<nav class="menu"><ul><li><a href="/a">A</a></li><li><a href="/b">B</a></li></ul></nav>
+<div class="sidebar"><p>Subscribe to the newsletter, follow us, share this, and more links here.</p></div>
+<div id="main-content" class="post">
+  <h1>Reading feeds in the terminal</h1>
+  <p>Feeds are a simple, durable way to follow writing on the web, and a terminal reader keeps them close at hand.</p>
+  <p>The reader stores items locally, marks them read, and can fetch the full article when a feed only carries a teaser.</p>
+  <p>See <a href="../docs/intro.html">the introduction</a> for more, with <img src="/img/shot.png" alt="a screenshot" onload="x()"> included.</p>
+  <div class="share social"><a href="https://share.test/">Share</a></div>
+</div>
+<footer><p>Copyright, all rights reserved, and some other boilerplate text here.</p></footer>
+</body></html>`
+
+func TestExtractArticle(t *testing.T) {
+	base, _ := url.Parse("https://blog.test/posts/terminal.html")
+	got, err := extractArticle(strings.NewReader(articlePage), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Reading feeds in the terminal", true},
+		{"a terminal reader keeps them close at hand", true},
+		{`href="https://blog.test/docs/intro.html"`, true},
+		{`src="https://blog.test/img/shot.png"`, true},
+		{`alt="a screenshot"`, true},
+		{"onload", false},
+		{"tracking", false},
+		{"newsletter", false},
+		{"About", false},
+		{"Share", false},
+		{"Copyright", false},
+		{"class=", false},
+	}
+	for _, tt := range tests {
+		if strings.Contains(got, tt.text) != tt.want {
+			t.Errorf("article contains %q = %v, want %v\n%s", tt.text, !tt.want, tt.want, got)
+		}
+	}
+}
+
+func TestExtractArticleNone(t *testing.T) {
+	pages := []string{
+		``,
+		`<html><body><nav><p>Only navigation, with links, and nothing else worth reading at all.</p></nav></body></html>`,
+		`<html><body><div class="post"><p>Too short to be an article.</p></div></body></html>`,
+	}
+	for _, page := range pages {
+		if got, err := extractArticle(strings.NewReader(page), nil); !errors.Is(err, errNoArticle) {
+			t.Errorf("extractArticle(%.40q) = %q, %v; want errNoArticle", page, got, err)
+		}
+	}
+}
+
+func TestFullTextCached(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/post":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(articlePage))
+		case "/data":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	f := NewFetcher(newTestStore(t, 10))
+
+	for i := 0; i < 2; i++ {
+		got, err := f.fullText(context.Background(), srv.URL+"/post")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "Reading feeds in the terminal") {
+			t.Errorf("fetch %d: article = %q", i, got)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("article fetched %d times, want once", n)
+	}
+
+	for _, path := range []string{"/data", "/missing"} {
+		if _, err := f.fullText(context.Background(), srv.URL+path); err == nil {
+			t.Errorf("%s: no error", path)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// reading.go implements rss open and rss cat, which act on listed items
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// lastListingFile caches the IDs of the most recent listing, in display
+// order, so "rss open 37" means item 37 of what was last shown
+const lastListingFile = "last_listing.json"
+
+// saveLastListing records the order of items as last displayed
+func saveLastListing(dir string, items []FeedItem) error {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	// Write atomically
+	path := filepath.Join(dir, lastListingFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// loadLastListing returns the item IDs of the last listing
+func loadLastListing(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, lastListingFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("%s: %w", lastListingFile, err)
+	}
+	return ids, nil
+}
+
+// resolveItem finds the item referred to by ref: a 1-based index into the
+// last listing, or an item ID as accepted by FeedStore.Find
+func resolveItem(dir string, store *FeedStore, ref string) (FeedItem, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		ids, err := loadLastListing(dir)
+		if err != nil {
+			return FeedItem{}, err
+		}
+		if n < 1 || n > len(ids) {
+			return FeedItem{}, fmt.Errorf("no item %d in the last listing (%d items)", n, len(ids))
+		}
+		ref = ids[n-1]
+	}
+	return store.Find(ref)
+}
+
+// cmdOpen opens an item's link in the browser and marks it read
+func cmdOpen(cfg *Config, store *FeedStore, args []string) error {
+	if len(args) != 1 {
+		return usagef("usage: rss open <index|id>")
+	}
+
+	item, err := resolveItem(cfg.DataDir, store, args[0])
+	if err != nil {
+		return err
+	}
+	if err := openBrowser(item.Link); err != nil {
+		return err
+	}
+
+	_, err = store.Update(item.ID, func(item *FeedItem) {
+		item.Read = true
+	})
+	return err
+}
+
+// cmdCat shows an item's stored content through $PAGER
+func cmdCat(cfg *Config, store *FeedStore, args []string) error {
+	if len(args) != 1 {
+		return usagef("usage: rss cat <index|id>")
+	}
+
+	item, err := resolveItem(cfg.DataDir, store, args[0])
+	if err != nil {
+		return err
+	}
+	color := term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+	return page(renderItem(item, 78, color))
+}
+
+// renderItem formats an item's header and content as text, styled with
+// ANSI escapes when color is set
+func renderItem(item FeedItem, width int, color bool) string {
+	style := func(on, s string) string {
+		if !color {
+			return s
+		}
+		return on + s + ansiReset
+	}
+
+	var b strings.Builder
+	for _, line := range wrapText(item.Title, width) {
+		fmt.Fprintln(&b, style(ansiBold, line))
+	}
+	fmt.Fprintln(&b, style(ansiDim, fmt.Sprintf("%s · %s", item.Feed, item.Published.Format("2006-01-02 15:04"))))
+	if item.Author != "" {
+		fmt.Fprintf(&b, "By %s\n", item.Author)
+	}
+	if len(item.Tags) > 0 {
+		fmt.Fprintf(&b, "#%s\n", strings.Join(item.Tags, " #"))
+	}
+	fmt.Fprintf(&b, "%s\n\n", item.Link)
+
+	content := contentText(item, width, color)
+	if content == "" {
+		content = "(no content stored for this item)"
+	}
+	fmt.Fprintln(&b, content)
+	return b.String()
+}
+
+// contentText renders an item's content as wrapped text with its links
+// footnoted
+func contentText(item FeedItem, width int, color bool) string {
+	opts := textOptions{Width: width, ANSI: color, Links: true}
+	if base, err := url.Parse(item.Link); err == nil {
+		opts.Base = base
+	}
+	return renderText(item.Content, opts)
+}
+
+// page writes text through $PAGER when stdout is a terminal, falling back
+// to less, and straight to stdout otherwise
+func page(text string) error {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		_, err := io.WriteString(os.Stdout, text)
+		return err
+	}
+
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less", "-R"}
+	}
+	if _, err := exec.LookPath(pager[0]); err != nil {
+		_, err := io.WriteString(os.Stdout, text)
+		return err
+	}
+
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveItem(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, 10)
+	items := []FeedItem{testItem("Blog", 1), testItem("Blog", 2), testItem("News", 3)}
+	if _, err := store.Add(items); err != nil {
+		t.Fatal(err)
+	}
+
+	// Before anything was listed only IDs work
+	if _, err := resolveItem(dir, store, "1"); err == nil {
+		t.Error("index without a listing: no error")
+	}
+
+	// Listed newest first
+	if err := saveLastListing(dir, []FeedItem{items[2], items[1], items[0]}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ref  string
+		want string // ID, "" for an error
+	}{
+		{"1", "News-3"},
+		{"3", "Blog-1"},
+		{"0", ""},
+		{"4", ""},
+		{"Blog-2", "Blog-2"},
+		{"News", "News-3"},
+		{"Blog", ""}, // ambiguous
+	}
+	for _, tt := range tests {
+		item, err := resolveItem(dir, store, tt.ref)
+		if item.ID != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("resolveItem(%q) = %q, %v; want %q", tt.ref, item.ID, err, tt.want)
+		}
+	}
+}
+
+func TestRenderItem(t *testing.T) {
+	item := testItem("Blog", 1)
+	item.Author = "Jane"
+	item.Tags = []string{"go", "work"}
+	item.Content = `<p>Read <a href="/more">the rest</a>.</p>`
+
+	got := renderItem(item, 40, false)
+	for _, want := range []string{
+		"Blog at hour 1\n",
+		"Blog · 2024-01-01 01:00\n",
+		"By Jane\n",
+		"#go #work\n",
+		"https://blog.test/1\n",
+		"https://blog.test/more",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("render lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "\x1b[") {
+		t.Errorf("render without color has escapes:\n%q", got)
+	}
+	if colored := renderItem(item, 40, true); !strings.Contains(colored, ansiBold+"Blog at hour 1"+ansiReset) {
+		t.Errorf("colored title missing:\n%q", colored)
+	}
+
+	item.Content = ""
+	if got := renderItem(item, 40, false); !strings.Contains(got, "(no content stored for this item)") {
+		t.Errorf("render of an empty item:\n%s", got)
+	}
+}
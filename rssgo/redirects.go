@@ -0,0 +1,144 @@
+// redirects.go tracks redirect chains and rewrites moved subscriptions
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultRedirectThreshold is how many fetches in a row must end at the
+// same permanently redirected URL before the subscription is rewritten
+const defaultRedirectThreshold = 3
+
+// errGone is returned for feeds that answer 410 Gone
+var errGone = errors.New("HTTP 410 Gone: feed removed, marked dead")
+
+// redirectHop is one redirect followed while fetching a feed
+type redirectHop struct {
+	Status int
+	From   string
+	To     string
+}
+
+// redirectLogKey is the context key under which fetchFeed passes the
+// slice that logRedirect appends to
+type redirectLogKey struct{}
+
+// withRedirectLog returns a context that collects redirect hops into log
+func withRedirectLog(ctx context.Context, log *[]redirectHop) context.Context {
+	return context.WithValue(ctx, redirectLogKey{}, log)
+}
+
+// logRedirect is the fetcher's http.Client.CheckRedirect. It records each
+// hop and keeps the default limit of 10 redirects.
+func logRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	log, ok := req.Context().Value(redirectLogKey{}).(*[]redirectHop)
+	if ok && req.Response != nil {
+		*log = append(*log, redirectHop{
+			Status: req.Response.StatusCode,
+			From:   via[len(via)-1].URL.String(),
+			To:     req.URL.String(),
+		})
+	}
+	return nil
+}
+
+// isPermanentRedirect reports whether status moves a resource for good
+func isPermanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// observeRedirects records the redirect chain of a successful fetch in m
+// and returns the URL the subscription should move to, if any. Only chains
+// made entirely of permanent redirects count, and the target has to be the
+// same for threshold consecutive fetches.
+func observeRedirects(m *FeedMeta, hops []redirectHop, threshold int) string {
+	m.LastRedirects = nil
+	permanent := len(hops) > 0
+	for _, h := range hops {
+		m.LastRedirects = append(m.LastRedirects, fmt.Sprintf("%d %s", h.Status, h.To))
+		if !isPermanentRedirect(h.Status) {
+			permanent = false
+		}
+	}
+
+	if !permanent {
+		m.RedirectTarget = ""
+		m.RedirectCount = 0
+		return ""
+	}
+
+	target := hops[len(hops)-1].To
+	if target == m.RedirectTarget {
+		m.RedirectCount++
+	} else {
+		m.RedirectTarget = target
+		m.RedirectCount = 1
+	}
+
+	if m.RedirectCount >= threshold {
+		return target
+	}
+	return ""
+}
+
+// markGone flags a feed that answered 410 Gone
+func markGone(m *FeedMeta) {
+	if !m.Dead {
+		m.DeadSince = time.Now()
+	}
+	m.Dead = true
+	m.DeadReason = "410 Gone"
+}
+
+// MoveFeed rewrites the subscription from to the URL to, keeping its
+// metadata and remembering the old address
+func (s *FeedStore) MoveFeed(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.meta[from]
+	if !ok {
+		return fmt.Errorf("unknown feed %s", from)
+	}
+	delete(s.meta, from)
+
+	// Already subscribed under the new URL: keep that entry
+	if existing, ok := s.meta[to]; ok {
+		existing.PreviousURLs = append(existing.PreviousURLs, from)
+		return s.saveMeta()
+	}
+
+	m.URL = to
+	m.PreviousURLs = append(m.PreviousURLs, from)
+	m.RedirectTarget = ""
+	m.RedirectCount = 0
+	s.meta[to] = m
+
+	return s.saveMeta()
+}
+
+// ResolveURL maps a feed URL to its current subscription URL, following
+// permanent moves recorded by MoveFeed
+func (s *FeedStore) ResolveURL(url string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.meta[url]; ok {
+		return url
+	}
+	for _, m := range s.meta {
+		for _, prev := range m.PreviousURLs {
+			if prev == url {
+				return m.URL
+			}
+		}
+	}
+	return url
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestObserveRedirects(t *testing.T) {
+	perm := func(to string) redirectHop { return redirectHop{Status: 301, From: "https://old.test/feed", To: to} }
+	temp := func(to string) redirectHop { return redirectHop{Status: 302, From: "https://old.test/feed", To: to} }
+
+	tests := []struct {
+		name      string
+		fetches   [][]redirectHop
+		wantMove  string // result of the last fetch
+		wantCount int
+	}{
+		{"no redirect", [][]redirectHop{nil}, "", 0},
+		{"one permanent", [][]redirectHop{{perm("https://new.test/feed")}}, "", 1},
+		{"threshold reached", [][]redirectHop{{perm("https://new.test/feed")}, {perm("https://new.test/feed")}, {perm("https://new.test/feed")}}, "https://new.test/feed", 3},
+		{"308 counts", [][]redirectHop{{{Status: 308, To: "https://new.test/feed"}}, {{Status: 308, To: "https://new.test/feed"}}, {{Status: 308, To: "https://new.test/feed"}}}, "https://new.test/feed", 3},
+		{"target changed", [][]redirectHop{{perm("https://a.test/feed")}, {perm("https://a.test/feed")}, {perm("https://b.test/feed")}}, "", 1},
+		{"temporary hop", [][]redirectHop{{perm("https://new.test/feed")}, {perm("https://new.test/feed")}, {perm("https://mid.test/feed"), temp("https://new.test/feed")}}, "", 0},
+		{"streak broken", [][]redirectHop{{perm("https://new.test/feed")}, {perm("https://new.test/feed")}, nil}, "", 0},
+	}
+	for _, tt := range tests {
+		var m FeedMeta
+		var move string
+		for _, hops := range tt.fetches {
+			move = observeRedirects(&m, hops, defaultRedirectThreshold)
+		}
+		if move != tt.wantMove || m.RedirectCount != tt.wantCount {
+			t.Errorf("%s: move = %q, count %d; want %q, %d", tt.name, move, m.RedirectCount, tt.wantMove, tt.wantCount)
+		}
+		if last := tt.fetches[len(tt.fetches)-1]; len(m.LastRedirects) != len(last) {
+			t.Errorf("%s: last redirects = %q, want %d hops", tt.name, m.LastRedirects, len(last))
+		}
+	}
+}
+
+func TestMoveFeedOntoExistingSubscription(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 10)
+	fetcher := NewFetcher(store)
+	old, current := srv.URLFor("/feed/rss2.xml"), srv.URLFor("/feed/atom.xml")
+	if err := fetcher.FetchAll(context.Background(), []string{old, current}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.MoveFeed(old, current); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.MetaFor(old); ok {
+		t.Error("old subscription kept")
+	}
+	if got := store.ResolveURL(old); got != current {
+		t.Errorf("ResolveURL(old) = %s, want %s", got, current)
+	}
+	if err := store.MoveFeed(old, current); err == nil {
+		t.Error("moving an unknown feed: no error")
+	}
+}
+
+func TestGoneFeedIsMarkedDead(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 10)
+	fetcher := NewFetcher(store)
+	gone := srv.URLFor("/status/410")
+
+	if _, err := fetcher.UpdateFeed(context.Background(), gone); !errors.Is(err, errGone) {
+		t.Fatalf("err = %v, want %v", err, errGone)
+	}
+	m, ok := store.MetaFor(gone)
+	if !ok || !m.Dead || m.DeadReason != "410 Gone" || m.DeadSince.IsZero() {
+		t.Errorf("meta = %+v, want dead since now for 410 Gone", m)
+	}
+
+	// Marking it again keeps the original time
+	since := m.DeadSince
+	markGone(&m)
+	if !m.DeadSince.Equal(since) {
+		t.Errorf("DeadSince moved from %v to %v", since, m.DeadSince)
+	}
+}
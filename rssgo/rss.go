@@ -4,24 +4,20 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
-	
-	"context"
-	
-	"github.com/peterbourgon/ff/v3"
-	flag "github.com/spf13/pflag"
-	"golang.org/x/net/html"
 )
 
 // Config holds application configuration
@@ -29,14 +25,41 @@ type Config struct {
 	Feeds      []string
 	Limit      int
 	Output     string
-	Since      time.Duration
+	OutputFile string
+	Since      string // date expression or range, see parseTimeExpr
+	Until      string
 	MaxPerFeed int
 	NoCache    bool
 	Update     bool
 	Purge      bool
+	PurgeAge   string
 	DataDir    string
 	Format     string
 	Reverse    bool
+	Tags       []string
+	Filter     string
+	Unread     bool
+	Duplicates bool // list every copy of stories found in several feeds
+	Sort       string
+	Offset     int
+	Cursor     string
+	Oldest     bool // page from the oldest items instead of the newest
+	Group      bool // list each feed's items together
+	
+	// Feed and category selection; Feeds also names URLs to fetch
+	ExcludeFeeds      []string
+	Categories        []string
+	ExcludeCategories []string
+	
+	// HTTP client settings
+	UserAgent          string
+	Proxy              string
+	CACerts            []string
+	ClientCert         string
+	ClientKey          string
+	InsecureSkipVerify bool
+	RedirectThreshold  int
+	DisableAfterDays   int
 }
 
 // FeedItem represents a single RSS item
@@ -49,6 +72,19 @@ type FeedItem struct {
 	ID        string    `json:"id"`
 	Read      bool      `json:"read"`
 	Starred   bool      `json:"starred"`
+	
+	Author     string   `json:"author,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Content    string   `json:"content,omitempty"` // HTML body or summary as published
+	
+	// Cluster names the group of items from several feeds that tell the
+	// same story; AlsoIn lists the other feeds when a listing collapses
+	// the group to one item
+	Cluster string   `json:"cluster,omitempty"`
+	AlsoIn  []string `json:"also_in,omitempty"`
+	
+	Enclosures []Enclosure `json:"enclosures,omitempty"`
 }
 
 // FeedStore manages feed storage
@@ -57,7 +93,8 @@ type FeedStore struct {
 	mu        sync.RWMutex
 	path      string
 	maxItems  int
-	lastFetch map[string]time.Time
+	meta      map[string]*FeedMeta
+	rules     *RuleSet
 }
 
 // NewFeedStore creates a new feed store
@@ -65,18 +102,29 @@ func NewFeedStore(path string, maxItems int) (*FeedStore, error) {
 	s := &FeedStore{
 		path:      path,
 		maxItems:  maxItems,
-		lastFetch: make(map[string]time.Time),
+		meta:      make(map[string]*FeedMeta),
 	}
 	
 	if err := s.load(); err != nil {
 		return nil, err
 	}
+	if err := s.loadMeta(); err != nil {
+		return nil, err
+	}
 	
 	return s, nil
 }
 
-// Add adds items maintaining chronological order
-func (s *FeedStore) Add(items []FeedItem) error {
+// SetRules sets the rules applied to new items by Add
+func (s *FeedStore) SetRules(rules *RuleSet) {
+	s.mu.Lock()
+	s.rules = rules
+	s.mu.Unlock()
+}
+
+// Add adds items maintaining chronological order and returns the ones
+// that were new, as stored after the rules ran
+func (s *FeedStore) Add(items []FeedItem) ([]FeedItem, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	
@@ -86,12 +134,19 @@ func (s *FeedStore) Add(items []FeedItem) error {
 		existing[item.ID] = true
 	}
 	
-	// Add new items
+	// Add new items, letting the rules drop or modify them
+	clusters := s.newClusterIndex()
+	var added []FeedItem
 	for _, item := range items {
 		if existing[item.ID] {
 			continue
 		}
+		if s.rules.Apply(&item).Dropped {
+			continue
+		}
+		s.assignCluster(&item, clusters)
 		s.items = append(s.items, item)
+		added = append(added, item)
 		existing[item.ID] = true
 	}
 	
@@ -108,62 +163,113 @@ func (s *FeedStore) Add(items []FeedItem) error {
 		s.items = s.items[len(s.items)-s.maxItems*len(s.uniqueFeeds()):]
 	}
 	
-	return s.save()
+	return added, s.save()
 }
 
-// List returns items with optional filtering
-func (s *FeedStore) List(limit int, feedFilter string, since time.Time, reverse bool) []FeedItem {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
-	var items []FeedItem
-	now := time.Now()
-	
-	// Apply filters
-	for _, item := range s.items {
-		// Filter by feed
-		if feedFilter != "" && !strings.Contains(item.Feed, feedFilter) {
-			continue
-		}
-		// Filter by date
-		if !since.IsZero() && item.Published.Before(since) {
-			continue
-		}
-		items = append(items, item)
+// ListOptions selects and orders the items returned by ListWith
+type ListOptions struct {
+	Limit     int
+	Offset    int       // skip this many items of the order first
+	Cursor    string    // continue after the item a previous page ended at
+	Tail      bool      // take the page from the end of the order
+	Sort      string    // published (default), added, feed or title
+	Feed      string    // substring of the feed title
+	FeedTitle string    // exact feed title
+	Since     time.Time // published at or after
+	Until     time.Time // published before
+	Reverse   bool      // descending order
+	Tags      []string  // items must carry every one of these tags
+	Query     string    // case-insensitive substring of title, feed or author
+	Unread    bool      // only unread items
+	Collapse  bool      // one item per cluster of duplicate stories
+	
+	// Feed title or subscription URL, and category patterns
+	Feeds             patternList
+	ExcludeFeeds      patternList
+	Categories        patternList
+	ExcludeCategories patternList
+	feedURLs          map[string][]string // set by Page
+}
+
+// Match reports whether item passes the filters in o
+func (o ListOptions) Match(item *FeedItem) bool {
+	// Filter by feed
+	if o.Feed != "" && !strings.Contains(item.Feed, o.Feed) {
+		return false
 	}
-	
-	// Apply ordering
-	if reverse {
-		sort.SliceStable(items, func(i, j int) bool {
-			return items[i].Published.After(items[j].Published)
-		})
-	} else {
-		sort.SliceStable(items, func(i, j int) bool {
-			return items[i].Published.Before(items[j].Published)
-		})
+	if o.FeedTitle != "" && item.Feed != o.FeedTitle {
+		return false
 	}
-	
-	// Apply limit
-	if limit > 0 && len(items) > limit {
-		items = items[:limit]
+	// Filter by date
+	if !o.Since.IsZero() && item.Published.Before(o.Since) {
+		return false
 	}
-	
-	return items
+	if !o.Until.IsZero() && !item.Published.Before(o.Until) {
+		return false
+	}
+	if o.Unread && item.Read {
+		return false
+	}
+	if len(o.Feeds) > 0 && !o.Feeds.matchFeed(item.Feed, o.feedURLs[item.Feed]) {
+		return false
+	}
+	if o.ExcludeFeeds.matchFeed(item.Feed, o.feedURLs[item.Feed]) {
+		return false
+	}
+	if len(o.Categories) > 0 && !o.Categories.matchAny(item.Categories) {
+		return false
+	}
+	if o.ExcludeCategories.matchAny(item.Categories) {
+		return false
+	}
+	for _, tag := range o.Tags {
+		if !hasFold(item.Tags, tag) {
+			return false
+		}
+	}
+	if o.Query != "" && !containsFold(item.Title, o.Query) &&
+		!containsFold(item.Feed, o.Query) && !containsFold(item.Author, o.Query) {
+		return false
+	}
+	return true
 }
 
-// UpdateFeed updates a specific feed
-func (s *FeedStore) UpdateFeed(ctx context.Context, url string) (int, error) {
-	items, err := fetchFeed(ctx, url)
-	if err != nil {
-		return 0, err
+// List returns items with optional filtering
+func (s *FeedStore) List(limit int, feedFilter string, since time.Time, reverse bool) []FeedItem {
+	return s.ListWith(ListOptions{
+		Limit:   limit,
+		Feed:    feedFilter,
+		Since:   since,
+		Reverse: reverse,
+	})
+}
+
+// ListWith returns the items selected by opts
+func (s *FeedStore) ListWith(opts ListOptions) []FeedItem {
+	return s.Page(opts).Items
+}
+
+// defaultPurgeAge is how old items removed by --purge are
+const defaultPurgeAge = "30d"
+
+// Purge removes items published before cutoff, except starred ones, and
+// returns how many it removed
+func (s *FeedStore) Purge(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.items[:0]
+	for _, item := range s.items {
+		if item.Starred || !item.Published.Before(cutoff) {
+			kept = append(kept, item)
+		}
 	}
-	
-	if err := s.Add(items); err != nil {
-		return 0, err
+	removed := len(s.items) - len(kept)
+	s.items = kept
+	if removed == 0 {
+		return 0, nil
 	}
-	
-	s.lastFetch[url] = time.Now()
-	return len(items), nil
+	return removed, s.save()
 }
 
 // truncatePerFeed keeps only latest items per feed
@@ -233,11 +339,9 @@ func (s *FeedStore) load() error {
 	return nil
 }
 
-// save saves items to disk
+// save saves items to disk; the caller must hold s.mu
 func (s *FeedStore) save() error {
-	s.mu.RLock()
 	data, err := json.MarshalIndent(s.items, "", "  ")
-	s.mu.RUnlock()
 	if err != nil {
 		return err
 	}
@@ -252,11 +356,18 @@ func (s *FeedStore) save() error {
 
 // Fetcher handles concurrent feed fetching
 type Fetcher struct {
-	store  *FeedStore
-	client *http.Client
-	sem    chan struct{}
-	mu     sync.Mutex
-	stats  map[string]int
+	store             *FeedStore
+	client            *http.Client
+	userAgent         string
+	redirectThreshold int
+	disableAfter      time.Duration // disable feeds failing this long, 0 never
+	noCache           bool          // fetch unconditionally, ignoring ETag and Last-Modified
+	sem               chan struct{}
+	mu                sync.Mutex
+	stats             map[string]int
+	fresh             []FeedItem // items added since the last notification
+	notifier          *Notifier
+	links             *LinkRules
 }
 
 // NewFetcher creates a new fetcher
@@ -264,22 +375,133 @@ func NewFetcher(store *FeedStore) *Fetcher {
 	return &Fetcher{
 		store: store,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
+			Timeout:       30 * time.Second,
+			Transport:     newTransport(),
+			CheckRedirect: logRedirect,
 		},
-		sem:   make(chan struct{}, 5), // Limit concurrent fetches
-		stats: make(map[string]int),
+		userAgent:         defaultUserAgent,
+		redirectThreshold: defaultRedirectThreshold,
+		disableAfter:      defaultDisableAfter,
+		links:             &LinkRules{},
+		sem:               make(chan struct{}, 5), // Limit concurrent fetches
+		stats:             make(map[string]int),
+	}
+}
+
+// Configure applies the user agent, proxy and TLS settings from cfg.
+// It must be called before UseCredentials, which wraps the transport.
+func (f *Fetcher) Configure(cfg *Config) error {
+	transport, err := configureTransport(newTransport(), cfg)
+	if err != nil {
+		return err
 	}
+	f.client.Transport = transport
+	if cfg.UserAgent != "" {
+		f.userAgent = cfg.UserAgent
+	}
+	if cfg.RedirectThreshold > 0 {
+		f.redirectThreshold = cfg.RedirectThreshold
+	}
+	f.disableAfter = time.Duration(cfg.DisableAfterDays) * 24 * time.Hour
+	f.noCache = cfg.NoCache
+	return nil
+}
+
+// UseCredentials makes the fetcher authenticate requests and add custom
+// headers according to creds
+func (f *Fetcher) UseCredentials(creds *Credentials) {
+	f.client.Transport = &authTransport{
+		base:  f.client.Transport,
+		creds: creds,
+	}
+}
+
+// UpdateFeed updates a specific feed
+func (f *Fetcher) UpdateFeed(ctx context.Context, url string) (int, error) {
+	start := time.Now()
+	res, err := f.fetchFeed(ctx, url)
+	attempt := FetchAttempt{Time: start, Status: res.Status, Latency: time.Since(start)}
+	if err != nil {
+		attempt.Error = redact(err.Error())
+		merr := f.store.UpdateMeta(url, func(m *FeedMeta) {
+			if errors.Is(err, errGone) {
+				markGone(m)
+			}
+			recordAttempt(m, attempt, f.disableAfter)
+		})
+		if merr != nil {
+			return 0, merr
+		}
+		return 0, err
+	}
+	
+	items := res.Items
+	f.normalizeLinks(ctx, items)
+	if m, ok := f.store.MetaFor(url); ok && m.FullText {
+		f.fillFullText(ctx, items)
+	}
+	added, err := f.store.Add(items)
+	if err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	f.fresh = append(f.fresh, added...)
+	f.mu.Unlock()
+	attempt.New = len(added)
+	
+	var moveTo string
+	err = f.store.UpdateMeta(url, func(m *FeedMeta) {
+		m.LastFetch = time.Now()
+		if m.Title == "" && len(items) > 0 {
+			m.Title = items[0].Feed
+		}
+		m.Fetches++
+		// A 304 has no body, so the last full response's encoding, sizes
+		// and validators stay
+		if !res.NotModified {
+			m.Encoding = res.Transfer.Encoding
+			m.BytesCompressed = res.Transfer.Compressed
+			m.BytesUncompressed = res.Transfer.Uncompressed
+			m.Etag = res.Etag
+			m.LastModified = res.LastModified
+		}
+		m.TotalCompressed += res.Transfer.Compressed
+		m.TotalUncompressed += res.Transfer.Uncompressed
+		m.Dead = false
+		m.DeadReason = ""
+		recordAttempt(m, attempt, f.disableAfter)
+		if interval := postingInterval(items); interval > 0 {
+			m.PostingInterval = interval
+		}
+		moveTo = observeRedirects(m, res.Redirects, f.redirectThreshold)
+	})
+	if err != nil {
+		return len(items), err
+	}
+	
+	// Items are keyed by ID, not by subscription URL, so moving the
+	// subscription keeps them attached
+	if moveTo != "" {
+		if err := f.store.MoveFeed(url, moveTo); err != nil {
+			return len(items), err
+		}
+		fmt.Fprintf(warnOutput, "%s moved permanently, subscription updated to %s\n", redact(url), redact(moveTo))
+	}
+	return len(items), nil
 }
 
 // FetchAll fetches all feeds concurrently
 func (f *Fetcher) FetchAll(ctx context.Context, urls []string) error {
+	_, err := f.FetchCounts(ctx, urls)
+	return err
+}
+
+// FetchCounts is FetchAll, also returning the number of new items of each
+// feed this call fetched successfully
+func (f *Fetcher) FetchCounts(ctx context.Context, urls []string) (map[string]int, error) {
 	var wg sync.WaitGroup
 	errs := make(chan error, len(urls))
+	counts := make(map[string]int, len(urls))
 	
 	for _, url := range urls {
 		wg.Add(1)
@@ -296,7 +518,7 @@ func (f *Fetcher) FetchAll(ctx context.Context, urls []string) error {
 			}
 			
 			// Fetch feed
-			count, err := f.store.UpdateFeed(ctx, u)
+			count, err := f.UpdateFeed(ctx, u)
 			if err != nil {
 				errs <- fmt.Errorf("%s: %w", u, err)
 				return
@@ -304,6 +526,7 @@ func (f *Fetcher) FetchAll(ctx context.Context, urls []string) error {
 			
 			f.mu.Lock()
 			f.stats[u] = count
+			counts[u] = count
 			f.mu.Unlock()
 		}(url)
 	}
@@ -311,119 +534,230 @@ func (f *Fetcher) FetchAll(ctx context.Context, urls []string) error {
 	wg.Wait()
 	close(errs)
 	
-	// Return first error
+	f.notify(ctx)
+	
+	// Report every feed that failed
+	var all []error
 	for err := range errs {
-		if err != nil {
-			return err
-		}
+		all = append(all, err)
 	}
 	
-	return nil
+	return counts, errors.Join(all...)
+}
+
+// Stats returns the number of items fetched per feed URL
+func (f *Fetcher) Stats() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	
+	stats := make(map[string]int, len(f.stats))
+	for url, count := range f.stats {
+		stats[url] = count
+	}
+	return stats
 }
 
 // PrintStats prints fetch statistics
 func (f *Fetcher) PrintStats() {
 	fmt.Println("\nFetch Statistics:")
 	for url, count := range f.stats {
-		fmt.Printf("  %s: %d new items\n", url, count)
+		fmt.Printf("  %s: %d new items\n", redact(url), count)
 	}
 }
 
-// fetchFeed fetches and parses a single feed
-func fetchFeed(ctx context.Context, url string) ([]FeedItem, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// fetchResult describes one completed feed request
+type fetchResult struct {
+	Items     []FeedItem
+	Transfer  transferStats
+	Status    int
+	Redirects []redirectHop
+	
+	// Validators for the next conditional request; NotModified is set
+	// when the server answered 304 and there are no items
+	Etag         string
+	LastModified string
+	NotModified  bool
+}
+
+// fetchFeed fetches and parses a single feed. The result is non-nil even
+// when an error is returned, so callers can inspect the redirect chain.
+func (f *Fetcher) fetchFeed(ctx context.Context, url string) (*fetchResult, error) {
+	res := &fetchResult{}
+	
+	req, err := http.NewRequestWithContext(withRedirectLog(ctx, &res.Redirects), "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return res, err
 	}
 	
-	req.Header.Set("User-Agent", "RSS-Reader/1.0")
-	req.Header.Set("Accept", "application/rss+xml,application/atom+xml,application/xml")
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "application/rss+xml,application/atom+xml,application/feed+json,application/xml")
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	
+	// Ask only for changes since the last fetch
+	if m, ok := f.store.MetaFor(url); ok && !f.noCache {
+		if m.Etag != "" {
+			req.Header.Set("If-None-Match", m.Etag)
+		}
+		if m.LastModified != "" {
+			req.Header.Set("If-Modified-Since", m.LastModified)
+		}
+	}
 	
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := f.client.Do(req)
 	if err != nil {
-		return nil, err
+		return res, err
 	}
 	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	res.Status = resp.StatusCode
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		res.NotModified = true
+		return res, nil
+	case resp.StatusCode == http.StatusGone:
+		return res, errGone
+	case resp.StatusCode != http.StatusOK:
+		return res, fmt.Errorf("HTTP %d", resp.StatusCode)
 	}
 	
-	// Parse feed
-	return parseFeed(resp.Body, url)
-}
-
-// parseFeed parses RSS/Atom feed
-func parseFeed(r io.Reader, url string) ([]FeedItem, error) {
-	data, err := io.ReadAll(r)
+	body, err := newDecodedBody(resp)
 	if err != nil {
-		return nil, err
+		return res, err
 	}
 	
-	// Try Atom first, then RSS
-	if items := parseAtom(data, url); len(items) > 0 {
-		return items, nil
-	}
+	res.Etag = resp.Header.Get("ETag")
+	res.LastModified = resp.Header.Get("Last-Modified")
 	
-	return parseRSS(data, url)
-}
-
-// parseAtom parses Atom feed
-func parseAtom(data []byte, url string) []FeedItem {
-	// Simplified Atom parser
-	// In production, use a proper Atom parser
-	return []FeedItem{}
+	// Parse feed
+	res.Items, err = parseFeed(body, url)
+	res.Transfer = body.Stats()
+	return res, err
 }
 
-// parseRSS parses RSS feed
-func parseRSS(data []byte, url string) []FeedItem {
+// parseRSS parses an RSS 2.0 feed, or an RSS 1.0 (RDF) one, whose items
+// follow the channel instead of being inside it
+func parseRSS(data []byte, url string) ([]FeedItem, error) {
+	type Item struct {
+		Base       string   `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
+		Title      string   `xml:"title"`
+		Link       string   `xml:"link"`
+		Desc       string   `xml:"description"`
+		Encoded    string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		PubDate    string   `xml:"pubDate"`
+		DCDate     string   `xml:"http://purl.org/dc/elements/1.1/ date"` // RSS 1.0
+		GUID       string   `xml:"guid"`
+		Author     string   `xml:"author"`
+		Creator    string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Categories []string `xml:"category"`
+		
+		Enclosures []struct {
+			URL    string `xml:"url,attr"`
+			Type   string `xml:"type,attr"`
+			Length string `xml:"length,attr"`
+		} `xml:"enclosure"`
+		ItunesDuration string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+		ItunesAuthor   string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+		ItunesSummary  string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	}
 	type RSS struct {
+		Base    string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 		Channel struct {
+			Base  string `xml:"http://www.w3.org/XML/1998/namespace base,attr"`
 			Title string `xml:"title"`
-			Item  []struct {
-				Title   string `xml:"title"`
-				Link    string `xml:"link"`
-				Desc    string `xml:"description"`
-				PubDate string `xml:"pubDate"`
-				GUID    string `xml:"guid"`
-			} `xml:"item"`
+			Item  []Item `xml:"item"`
 		} `xml:"channel"`
+		Item []Item `xml:"item"` // RSS 1.0
 	}
 	
 	var rss RSS
-	if err := xml.Unmarshal(data, &rss); err != nil {
-		return nil
+	if err := decodeXML(data, &rss); err != nil {
+		return nil, err
 	}
 	
+	added := time.Now()
+	var badDates []string
+	feedTitle := cleanText(rss.Channel.Title)
+	
 	var items []FeedItem
-	for _, item := range rss.Channel.Item {
-		pubDate, _ := parseDate(item.PubDate)
+	for _, item := range append(rss.Channel.Item, rss.Item...) {
+		// Unparseable dates fall back to the first-seen time so the item
+		// sorts next to its neighbours instead of at year 1
+		date := item.PubDate
+		if date == "" {
+			date = item.DCDate
+		}
+		pubDate, err := parseDate(date)
+		if err != nil {
+			pubDate = added
+			badDates = append(badDates, date)
+		}
 		itemID := item.GUID
 		if itemID == "" {
 			itemID = item.Link
 		}
+		// Relative links resolve against the feed URL and any xml:base
+		bases := []string{url, rss.Base, rss.Channel.Base, item.Base}
+		link := resolveLink(item.Link, bases...)
+		author := item.Author
+		if author == "" {
+			author = item.Creator
+		}
+		if author == "" {
+			author = item.ItunesAuthor
+		}
+		content := item.Encoded
+		if content == "" {
+			content = item.Desc
+		}
+		if content == "" {
+			content = item.ItunesSummary
+		}
+		var enclosures []Enclosure
+		for _, e := range item.Enclosures {
+			if e.URL == "" {
+				continue
+			}
+			length, _ := strconv.ParseInt(strings.TrimSpace(e.Length), 10, 64)
+			enclosures = append(enclosures, Enclosure{
+				URL:      resolveLink(e.URL, bases...),
+				Type:     strings.TrimSpace(e.Type),
+				Length:   length,
+				Duration: parseItunesDuration(item.ItunesDuration),
+			})
+		}
+		var categories []string
+		for _, c := range item.Categories {
+			if c = cleanText(c); c != "" {
+				categories = append(categories, c)
+			}
+		}
 		
 		items = append(items, FeedItem{
-			Feed:      rss.Channel.Title,
-			Title:     cleanText(item.Title),
-			Link:      item.Link,
-			Published: pubDate,
-			Added:     time.Now(),
-			ID:        itemID,
+			Feed:       feedTitle,
+			Title:      cleanText(item.Title),
+			Link:       link,
+			Published:  pubDate,
+			Added:      added,
+			ID:         itemID,
+			Author:     cleanText(author),
+			Categories: categories,
+			Content:    strings.TrimSpace(content),
+			Enclosures: enclosures,
 		})
 	}
+	warnBadDates(url, badDates)
 	
-	return items
+	return items, nil
 }
 
 // Output formats
-func outputTable(items []FeedItem, showFeed bool) {
+func outputTable(w io.Writer, items []FeedItem, showFeed bool) error {
 	if len(items) == 0 {
-		fmt.Println("No items found")
-		return
+		_, err := fmt.Fprintln(w, "No items found")
+		return err
 	}
 	
-	fmt.Printf("Found %d items:\n\n", len(items))
+	fmt.Fprintf(w, "Found %d items:\n\n", len(items))
 	
 	for i, item := range items {
 		date := item.Published.Format("2006-01-02 15:04")
@@ -435,82 +769,64 @@ func outputTable(items []FeedItem, showFeed bool) {
 		if item.Starred {
 			star = "★"
 		}
+		title := item.Title
+		if len(item.Tags) > 0 {
+			title += "  #" + strings.Join(item.Tags, " #")
+		}
 		
-		if showFeed {
-			fmt.Printf("%3d. [%s] %s%s %s\n", i+1, date, read, star, item.Title)
-			fmt.Printf("     %s\n", item.Feed)
-		} else {
-			fmt.Printf("%3d. [%s] %s%s %s\n", i+1, date, read, star, item.Title)
+		// A header starts each run of items from the same feed
+		if showFeed && (i == 0 || items[i-1].Feed != item.Feed) {
+			count, unread := 0, 0
+			for _, next := range items[i:] {
+				if next.Feed != item.Feed {
+					break
+				}
+				count++
+				if !next.Read {
+					unread++
+				}
+			}
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s (%d items, %d unread)\n", item.Feed, count, unread)
+		}
+		fmt.Fprintf(w, "%3d. [%s] %s%s %s\n", i+1, date, read, star, title)
+		if len(item.AlsoIn) > 0 {
+			fmt.Fprintf(w, "     also in: %s\n", strings.Join(item.AlsoIn, ", "))
 		}
 	}
+	return nil
 }
 
-func outputJSON(items []FeedItem) error {
-	enc := json.NewEncoder(os.Stdout)
+func outputJSON(w io.Writer, items []FeedItem, showFeed bool) error {
+	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
 	return enc.Encode(items)
 }
 
-func outputCSV(items []FeedItem) {
-	fmt.Println("feed,title,link,published,read,starred")
+// outputCSV writes items as RFC 4180 CSV with a header row
+func outputCSV(w io.Writer, items []FeedItem, showFeed bool) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"feed", "title", "link", "published", "read", "starred", "author", "tags", "id"})
 	for _, item := range items {
-		fmt.Printf("%q,%q,%q,%s,%v,%v\n",
+		cw.Write([]string{
 			item.Feed,
 			item.Title,
 			item.Link,
 			item.Published.Format(time.RFC3339),
-			item.Read,
-			item.Starred,
-		)
+			strconv.FormatBool(item.Read),
+			strconv.FormatBool(item.Starred),
+			item.Author,
+			strings.Join(item.Tags, " "),
+			item.ID,
+		})
 	}
+	cw.Flush()
+	return cw.Error()
 }
 
 // Helpers
-func parseDate(s string) (time.Time, error) {
-	formats := []string{
-		time.RFC1123,
-		time.RFC1123Z,
-		time.RFC822,
-		time.RFC822Z,
-		time.RFC3339,
-		time.RFC3339Nano,
-		"Mon, 2 Jan 2006 15:04:05 -0700",
-		"2006-01-02T15:04:05Z07:00",
-		"2006-01-02 15:04:05",
-		"02 Jan 2006 15:04:05 MST",
-	}
-	
-	for _, f := range formats {
-		if t, err := time.Parse(f, s); err == nil {
-			return t, nil
-		}
-	}
-	return time.Time{}, fmt.Errorf("unknown format: %s", s)
-}
-
-func cleanText(s string) string {
-	s = strings.TrimSpace(s)
-	s = html.UnescapeString(s)
-	
-	// Remove HTML tags
-	var result strings.Builder
-	inTag := false
-	for _, r := range s {
-		switch r {
-		case '<':
-			inTag = true
-		case '>':
-			inTag = false
-		default:
-			if !inTag {
-				result.WriteRune(r)
-			}
-		}
-	}
-	
-	return strings.Join(strings.Fields(result.String()), " ")
-}
-
 func getDataDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -525,105 +841,92 @@ func getDataDir() (string, error) {
 	return dir, nil
 }
 
-// loadConfig loads configuration
-func loadConfig() (*Config, error) {
-	var cfg Config
-	
-	fs := flag.NewFlagSet("rss", flag.ContinueOnError)
-	
-	fs.StringSliceVarP(&cfg.Feeds, "feed", "f", []string{}, "Feed URLs (can specify multiple)")
-	fs.IntVarP(&cfg.Limit, "limit", "n", 100, "Maximum items to show")
-	fs.StringVarP(&cfg.Output, "output", "o", "table", "Output format: table, json, csv")
-	fs.DurationVarP(&cfg.Since, "since", "s", 0, "Show items since (e.g., 24h, 7d)")
-	fs.IntVarP(&cfg.MaxPerFeed, "max", "m", 100, "Maximum items to store per feed")
-	fs.BoolVar(&cfg.NoCache, "no-cache", false, "Disable cache")
-	fs.BoolVarP(&cfg.Update, "update", "u", false, "Update feeds")
-	fs.BoolVar(&cfg.Purge, "purge", false, "Purge old items")
-	fs.StringVar(&cfg.DataDir, "data-dir", "", "Data directory")
-	fs.StringVar(&cfg.Format, "format", "", "Custom format string")
-	fs.BoolVarP(&cfg.Reverse, "reverse", "r", false, "Reverse order (newest first)")
-	
-	// Parse flags
-	if err := ff.Parse(fs, os.Args[1:],
-		ff.WithEnvVarPrefix("RSS"),
-		ff.WithConfigFileFlag("config"),
-		ff.WithConfigFileParser(ff.PlainParser),
-	); err != nil {
+// newConfiguredFetcher creates a fetcher with the HTTP settings from cfg
+// and the credentials from the data directory
+func newConfiguredFetcher(cfg *Config, store *FeedStore) (*Fetcher, error) {
+	creds, err := LoadCredentials(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	fetcher := NewFetcher(store)
+	if err := fetcher.Configure(cfg); err != nil {
 		return nil, err
 	}
 	
-	// Get data directory
-	if cfg.DataDir == "" {
-		dir, err := getDataDir()
-		if err != nil {
-			return nil, err
-		}
-		cfg.DataDir = dir
+	// Webhooks go through the proxy and TLS settings, but never carry
+	// feed credentials
+	notifier, err := LoadNotifier(cfg.DataDir, fetcher.client.Transport)
+	if err != nil {
+		return nil, err
 	}
+	fetcher.notifier = notifier
 	
-	// Default feeds if none specified
-	if len(cfg.Feeds) == 0 && !cfg.Update {
-		cfg.Feeds = []string{
-			"https://blog.golang.org/feed.atom",
-		}
+	links, err := LoadLinkRules(cfg.DataDir)
+	if err != nil {
+		return nil, err
 	}
+	fetcher.links = links
 	
-	return &cfg, nil
+	fetcher.UseCredentials(creds)
+	return fetcher, nil
 }
 
 // Main function
 func main() {
-	cfg, err := loadConfig()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	os.Exit(run(os.Args[1:]))
+}
+
+// listOptions adds the paging, ordering and duplicate settings of cfg to
+// the filters in opts. Without -r or --oldest a date-ordered listing shows
+// the newest items, oldest first.
+func (cfg *Config) listOptions(opts ListOptions) ListOptions {
+	opts.Limit = cfg.Limit
+	opts.Offset = cfg.Offset
+	opts.Cursor = cfg.Cursor
+	opts.Sort = cfg.Sort
+	opts.Reverse = cfg.Reverse
+	opts.Tail = !cfg.Reverse && !cfg.Oldest && timeSort(cfg.Sort)
+	opts.Collapse = !cfg.Duplicates
+	return opts
+}
+
+// selection compiles the feed and category patterns of cfg into list
+// options
+func (cfg *Config) selection() (ListOptions, error) {
+	var opts ListOptions
+	var err error
+	if opts.Feeds, err = compilePatterns(cfg.Feeds); err != nil {
+		return opts, fmt.Errorf("--feed: %w", err)
 	}
-	
-	// Create store
-	storePath := filepath.Join(cfg.DataDir, "feeds.json")
-	store, err := NewFeedStore(storePath, cfg.MaxPerFeed)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create store: %v\n", err)
-		os.Exit(1)
+	if opts.ExcludeFeeds, err = compilePatterns(cfg.ExcludeFeeds); err != nil {
+		return opts, fmt.Errorf("--exclude-feed: %w", err)
 	}
-	
-	// Update feeds if requested
-	if cfg.Update || len(cfg.Feeds) > 0 {
-		fetcher := NewFetcher(store)
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		defer cancel()
-		
-		if err := fetcher.FetchAll(ctx, cfg.Feeds); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to fetch feeds: %v\n", err)
-		}
-		fetcher.PrintStats()
+	if opts.Categories, err = compilePatterns(cfg.Categories); err != nil {
+		return opts, fmt.Errorf("--category: %w", err)
 	}
-	
-	// Calculate since time
-	var sinceTime time.Time
-	if cfg.Since > 0 {
-		sinceTime = time.Now().Add(-cfg.Since)
+	if opts.ExcludeCategories, err = compilePatterns(cfg.ExcludeCategories); err != nil {
+		return opts, fmt.Errorf("--exclude-category: %w", err)
 	}
-	
-	// List items
-	items := store.List(cfg.Limit, "", sinceTime, cfg.Reverse)
-	
-	// Output
-	switch cfg.Output {
-	case "json":
-		if err := outputJSON(items); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to output JSON: %v\n", err)
-		}
-	case "csv":
-		outputCSV(items)
-	default:
-		outputTable(items, len(cfg.Feeds) > 1)
+	return opts, nil
+}
+
+// outputItems writes items in the format selected by cfg.Output and
+// remembers their order for rss open and rss cat
+func outputItems(cfg *Config, items []FeedItem, showFeed bool) error {
+	if cfg.Group {
+		items = groupItemsByFeed(items)
+		showFeed = true
+	}
+	if err := saveLastListing(cfg.DataDir, items); err != nil {
+		return err
 	}
+	
+	return exportItems(cfg.Output, cfg.OutputFile, items, showFeed)
 }
 //optimal batch function
 // BatchProcessor processes feeds in batches
 type BatchProcessor struct {
-	store     *PersistentStore
+	store     *FeedStore
 	fetcher   *Fetcher
 	batchSize int
 	interval  time.Duration
@@ -631,17 +934,18 @@ type BatchProcessor struct {
 }
 
 // NewBatchProcessor creates a new batch processor
-func NewBatchProcessor(store *PersistentStore, batchSize int, interval time.Duration) *BatchProcessor {
+func NewBatchProcessor(fetcher *Fetcher, batchSize int, interval time.Duration) *BatchProcessor {
 	return &BatchProcessor{
-		store:     store,
-		fetcher:   NewFetcher(store),
+		store:     fetcher.store,
+		fetcher:   fetcher,
 		batchSize: batchSize,
 		interval:  interval,
 		done:      make(chan struct{}),
 	}
 }
 
-// Start starts the batch processor
+// Start starts the batch processor. With no urls it fetches the store's
+// subscriptions, re-read every cycle so added and removed feeds are seen.
 func (bp *BatchProcessor) Start(ctx context.Context, urls []string) {
 	ticker := time.NewTicker(bp.interval)
 	defer ticker.Stop()
@@ -663,6 +967,10 @@ func (bp *BatchProcessor) Start(ctx context.Context, urls []string) {
 
 // fetchBatch fetches a batch of feeds
 func (bp *BatchProcessor) fetchBatch(ctx context.Context, urls []string) {
+	if len(urls) == 0 {
+		urls = bp.store.Subscriptions()
+	}
+	
 	// Process in batches
 	for i := 0; i < len(urls); i += bp.batchSize {
 		end := i + bp.batchSize
@@ -673,6 +981,7 @@ func (bp *BatchProcessor) fetchBatch(ctx context.Context, urls []string) {
 		batch := urls[i:end]
 		if err := bp.fetcher.FetchAll(ctx, batch); err != nil {
 			// Log error but continue
+			fmt.Fprintln(warnOutput, redact(err.Error()))
 			continue
 		}
 		
@@ -711,6 +1020,42 @@ type FeedMeta struct {
 	Updated   time.Time `json:"updated"`
 	Etag      string    `json:"etag,omitempty"`
 	LastFetch time.Time `json:"last_fetch"`
+	
+	// Validators of the last full response, sent back so unchanged feeds
+	// answer 304
+	LastModified string `json:"last_modified,omitempty"`
+	
+	// Transfer accounting; Bytes* describe the last fetch, Total* all
+	// fetches. Compressed counts bytes on the wire, Uncompressed the
+	// decoded feed document.
+	Fetches           int    `json:"fetches,omitempty"`
+	Encoding          string `json:"encoding,omitempty"`
+	BytesCompressed   int64  `json:"bytes_compressed,omitempty"`
+	BytesUncompressed int64  `json:"bytes_uncompressed,omitempty"`
+	TotalCompressed   int64  `json:"total_compressed,omitempty"`
+	TotalUncompressed int64  `json:"total_uncompressed,omitempty"`
+	
+	// Redirect tracking. RedirectTarget is the URL the last fetch ended up
+	// at via permanent redirects only, seen RedirectCount times in a row.
+	LastRedirects  []string  `json:"last_redirects,omitempty"`
+	RedirectTarget string    `json:"redirect_target,omitempty"`
+	RedirectCount  int       `json:"redirect_count,omitempty"`
+	PreviousURLs   []string  `json:"previous_urls,omitempty"`
+	Dead           bool      `json:"dead,omitempty"`
+	DeadSince      time.Time `json:"dead_since,omitempty"`
+	DeadReason     string    `json:"dead_reason,omitempty"`
+	
+	// Health. History holds the latest fetch attempts, oldest first.
+	History             []FetchAttempt `json:"history,omitempty"`
+	LastSuccess         time.Time      `json:"last_success,omitempty"`
+	LastNewItems        time.Time      `json:"last_new_items,omitempty"`
+	ConsecutiveFailures int            `json:"consecutive_failures,omitempty"`
+	FailingSince        time.Time      `json:"failing_since,omitempty"`
+	PostingInterval     time.Duration  `json:"posting_interval,omitempty"` // average gap between items
+	
+	// FullText replaces each new item's content with the article its
+	// link points to
+	FullText bool `json:"full_text,omitempty"`
 }
 
 // NewPersistentStore creates a new store
@@ -844,11 +1189,8 @@ func (s *PersistentStore) cleanupBucket(bucket *FeedBucket) {
 	bucket.Items = filtered
 }
 
-// Save saves store to disk
+// Save saves store to disk; the caller must hold s.mu
 func (s *PersistentStore) save() error {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
 		return err
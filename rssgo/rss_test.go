@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Parse warnings and fetch statistics are expected in these tests
+	warnOutput = io.Discard
+	os.Exit(m.Run())
+}
+
+// newTestStore returns an empty store in a temporary directory
+func newTestStore(t *testing.T, maxItems int) *FeedStore {
+	t.Helper()
+	store, err := NewFeedStore(filepath.Join(t.TempDir(), "feeds.json"), maxItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// testItem returns an item of feed published hour hours into 2024
+func testItem(feed string, hour int) FeedItem {
+	published := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hour) * time.Hour)
+	return FeedItem{
+		Feed:      feed,
+		Title:     fmt.Sprintf("%s at hour %d", feed, hour),
+		Link:      fmt.Sprintf("https://%s.test/%d", strings.ToLower(feed), hour),
+		ID:        fmt.Sprintf("%s-%d", feed, hour),
+		Published: published,
+		Added:     published,
+	}
+}
+
+// ids returns the IDs of items in order
+func ids(items []FeedItem) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.ID)
+	}
+	return out
+}
+
+// checkChronological fails unless items are ordered oldest first
+func checkChronological(t *testing.T, items []FeedItem) {
+	t.Helper()
+	if !sort.SliceIsSorted(items, func(i, j int) bool { return items[i].Published.Before(items[j].Published) }) {
+		t.Errorf("items are not in chronological order: %v", ids(items))
+	}
+}
+
+func TestFeedStoreOrdering(t *testing.T) {
+	store := newTestStore(t, 100)
+	if _, err := store.Add([]FeedItem{testItem("A", 5), testItem("B", 1), testItem("A", 3)}); err != nil {
+		t.Fatal(err)
+	}
+	added, err := store.Add([]FeedItem{testItem("B", 4), testItem("A", 3), testItem("A", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := strings.Join(ids(added), " "), "B-4 A-0"; got != want {
+		t.Errorf("added = %s, want %s (A-3 is a duplicate)", got, want)
+	}
+	all := store.ListWith(ListOptions{})
+	if got, want := strings.Join(ids(all), " "), "A-0 B-1 A-3 B-4 A-5"; got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+
+	// The order survives a reload
+	reloaded, err := NewFeedStore(store.path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(reloaded.ListWith(ListOptions{})); strings.Join(got, " ") != strings.Join(ids(all), " ") {
+		t.Errorf("after reload order = %v", got)
+	}
+}
+
+func TestFeedStoreKeepsNewestPerFeed(t *testing.T) {
+	store := newTestStore(t, 3)
+	var items []FeedItem
+	for hour := 0; hour < 10; hour++ {
+		items = append(items, testItem("A", hour))
+	}
+	items = append(items, testItem("B", 2))
+	if _, err := store.Add(items); err != nil {
+		t.Fatal(err)
+	}
+
+	all := store.ListWith(ListOptions{})
+	if got, want := strings.Join(ids(all), " "), "B-2 A-7 A-8 A-9"; got != want {
+		t.Errorf("kept %s, want %s", got, want)
+	}
+}
+
+func TestFeedStorePaging(t *testing.T) {
+	store := newTestStore(t, 100)
+	var items []FeedItem
+	for hour := 0; hour < 5; hour++ {
+		items = append(items, testItem("A", hour))
+	}
+	if _, err := store.Add(items); err != nil {
+		t.Fatal(err)
+	}
+
+	// The newest page comes first, each page oldest first
+	page := store.Page(ListOptions{Limit: 2, Tail: true})
+	if got := strings.Join(ids(page.Items), " "); got != "A-3 A-4" || page.Total != 5 {
+		t.Fatalf("first page = %s of %d", got, page.Total)
+	}
+	page = store.Page(ListOptions{Limit: 2, Tail: true, Cursor: page.Next})
+	if got := strings.Join(ids(page.Items), " "); got != "A-1 A-2" {
+		t.Errorf("second page = %s", got)
+	}
+	page = store.Page(ListOptions{Limit: 2, Tail: true, Cursor: page.Next})
+	if got := strings.Join(ids(page.Items), " "); got != "A-0" || page.Next != "" {
+		t.Errorf("last page = %s, next %q", got, page.Next)
+	}
+
+	page = store.Page(ListOptions{Limit: 2, Reverse: true})
+	if got := strings.Join(ids(page.Items), " "); got != "A-4 A-3" {
+		t.Errorf("reversed page = %s", got)
+	}
+}
+
+func TestUpdateFeedConditional(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	fetcher := NewFetcher(store)
+	url := srv.URLFor("/feed/rss2.xml")
+	ctx := context.Background()
+
+	if n, err := fetcher.UpdateFeed(ctx, url); err != nil || n != 3 {
+		t.Fatalf("first fetch: %d items, %v", n, err)
+	}
+	m, _ := store.MetaFor(url)
+	if m.Etag == "" || m.LastModified == "" {
+		t.Fatalf("validators not stored: etag %q, last-modified %q", m.Etag, m.LastModified)
+	}
+	full := m
+
+	// Unchanged: the server answers 304 and nothing is parsed
+	if n, err := fetcher.UpdateFeed(ctx, url); err != nil || n != 0 {
+		t.Fatalf("second fetch: %d items, %v", n, err)
+	}
+	if got := srv.Conditional("/feed/rss2.xml"); got != 1 {
+		t.Errorf("%d conditional requests, want 1", got)
+	}
+	m, _ = store.MetaFor(url)
+	if last := m.History[len(m.History)-1]; last.Status != 304 || last.Error != "" {
+		t.Errorf("last attempt = %+v, want a successful 304", last)
+	}
+	if m.Etag != full.Etag || m.LastModified != full.LastModified {
+		t.Error("304 changed the validators")
+	}
+	if m.Encoding != full.Encoding || m.BytesCompressed != full.BytesCompressed ||
+		m.BytesUncompressed != full.BytesUncompressed || m.BytesUncompressed == 0 {
+		t.Errorf("304 changed the transfer stats: %q %d/%d, want %q %d/%d",
+			m.Encoding, m.BytesCompressed, m.BytesUncompressed,
+			full.Encoding, full.BytesCompressed, full.BytesUncompressed)
+	}
+	if got := len(store.ListWith(ListOptions{})); got != 3 {
+		t.Errorf("store holds %d items after 304, want 3", got)
+	}
+
+	// --no-cache fetches in full
+	fetcher.noCache = true
+	if n, err := fetcher.UpdateFeed(ctx, url); err != nil || n != 3 {
+		t.Fatalf("no-cache fetch: %d items, %v", n, err)
+	}
+	if got := srv.Conditional("/feed/rss2.xml"); got != 1 {
+		t.Errorf("no-cache request was conditional")
+	}
+}
+
+func TestUpdateFeedRedirects(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	fetcher := NewFetcher(store)
+	fetcher.redirectThreshold = 2
+	ctx := context.Background()
+
+	// Temporary redirects are followed but never move the subscription
+	temp := srv.URLFor("/temp/atom.xml")
+	for i := 0; i < 3; i++ {
+		if _, err := fetcher.UpdateFeed(ctx, temp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := store.ResolveURL(temp); got != temp {
+		t.Errorf("temporary redirect moved the subscription to %s", got)
+	}
+
+	// Permanent ones move it once seen redirectThreshold times
+	moved, target := srv.URLFor("/moved/rdf.xml"), srv.URLFor("/feed/rdf.xml")
+	if n, err := fetcher.UpdateFeed(ctx, moved); err != nil || n != 2 {
+		t.Fatalf("first fetch: %d items, %v", n, err)
+	}
+	if got := store.ResolveURL(moved); got != moved {
+		t.Fatalf("moved after one redirect, to %s", got)
+	}
+	if _, err := fetcher.UpdateFeed(ctx, moved); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.ResolveURL(moved); got != target {
+		t.Errorf("subscription resolves to %s, want %s", got, target)
+	}
+	if m, ok := store.MetaFor(target); !ok || !contains(m.PreviousURLs, moved) {
+		t.Errorf("target meta = %+v, want %s among previous URLs", m, moved)
+	}
+}
+
+func TestUpdateFeedErrors(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	fetcher := NewFetcher(store)
+	ctx := context.Background()
+
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{"/status/500", "HTTP 500"},
+		{"/status/404", "HTTP 404"},
+		{"/status/410", errGone.Error()},
+		{"/feed/truncated.xml", "XML syntax error"},
+		{"/feed/not-a-feed.html", errUnknownFormat.Error()},
+		{"/feed/broken.json", "JSON feed"},
+	}
+	for _, tt := range tests {
+		url := srv.URLFor(tt.path)
+		_, err := fetcher.UpdateFeed(ctx, url)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want %q", tt.path, err, tt.wantErr)
+			continue
+		}
+		m, _ := store.MetaFor(url)
+		if m.ConsecutiveFailures != 1 || len(m.History) != 1 || m.History[0].Error == "" {
+			t.Errorf("%s: failure not recorded: %+v", tt.path, m)
+		}
+	}
+
+	if m, _ := store.MetaFor(srv.URLFor("/status/410")); !m.Dead {
+		t.Error("410 Gone did not mark the feed dead")
+	}
+	if got := len(store.ListWith(ListOptions{})); got != 0 {
+		t.Errorf("failed fetches stored %d items", got)
+	}
+}
+
+func TestUpdateFeedSlow(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	fetcher := NewFetcher(store)
+
+	// Within the deadline a slow server is waited for
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if n, err := fetcher.UpdateFeed(ctx, srv.URLFor("/slow/50ms/rss2.xml")); err != nil || n != 3 {
+		t.Fatalf("slow fetch: %d items, %v", n, err)
+	}
+
+	// Past it the fetch is abandoned promptly
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := fetcher.UpdateFeed(ctx, srv.URLFor("/slow/10s/atom.xml"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timed out fetch took %s", elapsed)
+	}
+}
+
+func TestFetchAllReportsEveryFailure(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	fetcher := NewFetcher(store)
+
+	good := []string{srv.URLFor("/feed/rss2.xml"), srv.URLFor("/feed/feed.json")}
+	bad := []string{srv.URLFor("/status/503"), srv.URLFor("/feed/truncated.xml")}
+	err := fetcher.FetchAll(context.Background(), append(append([]string{}, good...), bad...))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, u := range bad {
+		if !strings.Contains(err.Error(), u) {
+			t.Errorf("error %q does not mention %s", err, u)
+		}
+	}
+
+	stats := fetcher.Stats()
+	if stats[good[0]] != 3 || stats[good[1]] != 2 {
+		t.Errorf("stats = %v", stats)
+	}
+	if got := len(store.ListWith(ListOptions{})); got != 5 {
+		t.Errorf("stored %d items, want 5", got)
+	}
+}
+
+// genURLs returns the URLs of n generated feeds with items each
+func genURLs(srv *fakeFeedServer, n, items int) []string {
+	var urls []string
+	for k := 0; k < n; k++ {
+		urls = append(urls, srv.URLFor(fmt.Sprintf("/gen/%d/feed%d.xml", items, k)))
+	}
+	return urls
+}
+
+// readWhile reads the store from several goroutines until stop is closed,
+// so the race detector sees reads interleaved with fetches
+func readWhile(store *FeedStore, stop <-chan struct{}) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				store.Page(ListOptions{Limit: 10, Tail: true, Collapse: true})
+				store.Meta()
+				store.Subscriptions()
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	return &wg
+}
+
+func TestFetchAllConcurrent(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	fetcher := NewFetcher(store)
+	urls := genURLs(srv, 12, 30)
+
+	stop := make(chan struct{})
+	readers := readWhile(store, stop)
+
+	// Two overlapping runs, as when the API refreshes while serve --watch
+	// is fetching
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fetcher.FetchAll(context.Background(), urls); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	items := store.ListWith(ListOptions{})
+	if len(items) != 12*30 {
+		t.Errorf("stored %d items, want %d", len(items), 12*30)
+	}
+	checkChronological(t, items)
+	if got := len(store.Subscriptions()); got != 12 {
+		t.Errorf("%d subscriptions, want 12", got)
+	}
+}
+
+func TestBatchProcessor(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	fetcher := NewFetcher(store)
+	urls := genURLs(srv, 5, 10)
+
+	// Subscribe without fetching; the processor reads the subscriptions
+	for _, u := range urls {
+		if err := store.UpdateMeta(u, func(m *FeedMeta) {}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stop := make(chan struct{})
+	readers := readWhile(store, stop)
+
+	bp := NewBatchProcessor(fetcher, 2, 20*time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		bp.Start(context.Background(), nil)
+		close(done)
+	}()
+
+	// Wait for every feed to be fetched at least twice
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		fetched := 0
+		for k := range urls {
+			if srv.Requests(fmt.Sprintf("/gen/10/feed%d.xml", k)) >= 2 {
+				fetched++
+			}
+		}
+		if fetched == len(urls) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d feeds fetched twice", fetched, len(urls))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	bp.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+	close(stop)
+	readers.Wait()
+
+	items := store.ListWith(ListOptions{})
+	if len(items) != 5*10 {
+		t.Errorf("stored %d items, want 50", len(items))
+	}
+	checkChronological(t, items)
+}
+
+func TestBatchProcessorContext(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 100)
+	bp := NewBatchProcessor(NewFetcher(store), 1, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bp.Start(ctx, []string{srv.URLFor("/gen/3/feed.xml")})
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Requests("/gen/3/feed.xml") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after the context was cancelled")
+	}
+	if got := len(store.ListWith(ListOptions{})); got != 3 {
+		t.Errorf("stored %d items, want 3", got)
+	}
+}
@@ -0,0 +1,201 @@
+// rules.go implements rule-based item filters and automatic actions
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// rulesFile is the name of the rules file in the data directory
+const rulesFile = "rules.json"
+
+// Rule actions
+const (
+	ActionDrop    = "drop"
+	ActionRead    = "read"
+	ActionStar    = "star"
+	ActionTag     = "tag"
+	ActionRewrite = "rewrite"
+)
+
+// Rule matches items and applies an action to them. Every non-empty
+// condition must match; a rule without conditions matches everything.
+type Rule struct {
+	Name string `json:"name"`
+
+	// Conditions
+	Feed     string `json:"feed,omitempty"`     // substring of the feed title, case-insensitive
+	Title    string `json:"title,omitempty"`    // regular expression on the title
+	Author   string `json:"author,omitempty"`   // substring of the author, case-insensitive
+	Category string `json:"category,omitempty"` // category name, case-insensitive
+	Host     string `json:"host,omitempty"`     // link host or a parent domain of it
+
+	// Action and its arguments
+	Action  string   `json:"action"`
+	Tags    []string `json:"tags,omitempty"`    // for "tag"
+	Pattern string   `json:"pattern,omitempty"` // for "rewrite", defaults to the whole title
+	Replace string   `json:"replace,omitempty"` // for "rewrite", may use $1 etc.
+
+	title   *regexp.Regexp
+	pattern *regexp.Regexp
+}
+
+// RuleSet is the ordered list of rules from the rules file
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+}
+
+// RuleResult reports what the rules did to one item
+type RuleResult struct {
+	Dropped bool
+	Matched []string // names of the rules that matched
+}
+
+// LoadRules reads the rules file from dir. A missing file yields an empty
+// rule set.
+func LoadRules(dir string) (*RuleSet, error) {
+	path := filepath.Join(dir, rulesFile)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &RuleSet{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rs RuleSet
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := rs.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &rs, nil
+}
+
+// compile validates the rules and compiles their regular expressions
+func (rs *RuleSet) compile() error {
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		switch r.Action {
+		case ActionDrop, ActionRead, ActionStar:
+		case ActionTag:
+			if len(r.Tags) == 0 {
+				return fmt.Errorf("%s: action tag needs tags", r.Name)
+			}
+		case ActionRewrite:
+			pattern := r.Pattern
+			if pattern == "" {
+				pattern = "^.*$"
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: pattern: %w", r.Name, err)
+			}
+			r.pattern = re
+		default:
+			return fmt.Errorf("%s: unknown action %q", r.Name, r.Action)
+		}
+
+		if r.Title != "" {
+			re, err := regexp.Compile(r.Title)
+			if err != nil {
+				return fmt.Errorf("%s: title: %w", r.Name, err)
+			}
+			r.title = re
+		}
+	}
+	return nil
+}
+
+// Match reports whether the rule's conditions all hold for item
+func (r *Rule) Match(item *FeedItem) bool {
+	if r.Feed != "" && !containsFold(item.Feed, r.Feed) {
+		return false
+	}
+	if r.title != nil && !r.title.MatchString(item.Title) {
+		return false
+	}
+	if r.Author != "" && !containsFold(item.Author, r.Author) {
+		return false
+	}
+	if r.Category != "" && !hasFold(item.Categories, r.Category) {
+		return false
+	}
+	if r.Host != "" && !hostMatches(item.Link, r.Host) {
+		return false
+	}
+	return true
+}
+
+// apply performs the rule's action on item
+func (r *Rule) apply(item *FeedItem) {
+	switch r.Action {
+	case ActionRead:
+		item.Read = true
+	case ActionStar:
+		item.Starred = true
+	case ActionTag:
+		item.Tags = editTags(item.Tags, r.Tags)
+	case ActionRewrite:
+		item.Title = strings.TrimSpace(r.pattern.ReplaceAllString(item.Title, r.Replace))
+	}
+}
+
+// Apply runs every rule against item in order, modifying it in place.
+// Evaluation stops at the first rule that drops the item.
+func (rs *RuleSet) Apply(item *FeedItem) RuleResult {
+	var res RuleResult
+	if rs == nil {
+		return res
+	}
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		if !r.Match(item) {
+			continue
+		}
+		res.Matched = append(res.Matched, r.Name)
+		if r.Action == ActionDrop {
+			res.Dropped = true
+			return res
+		}
+		r.apply(item)
+	}
+	return res
+}
+
+// containsFold reports whether substr is in s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// hasFold reports whether list contains s, ignoring case
+func hasFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostMatches reports whether link's host is host or a subdomain of it
+func hostMatches(link, host string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	h := strings.ToLower(u.Hostname())
+	host = strings.ToLower(host)
+	return h == host || strings.HasSuffix(h, "."+host)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRuleMatch(t *testing.T) {
+	item := FeedItem{
+		Feed:       "Hacker News",
+		Title:      "Show HN: A tiny RSS reader",
+		Author:     "Jane Doe",
+		Categories: []string{"Programming", "Go"},
+		Link:       "https://blog.example.com/rss-reader",
+	}
+	tests := []struct {
+		rule Rule
+		want bool
+	}{
+		{Rule{}, true},
+		{Rule{Feed: "hacker"}, true},
+		{Rule{Feed: "lobsters"}, false},
+		{Rule{Title: "^Show HN:"}, true},
+		{Rule{Title: "^Ask HN:"}, false},
+		{Rule{Author: "jane"}, true},
+		{Rule{Category: "go"}, true},
+		{Rule{Category: "gopher"}, false},
+		{Rule{Host: "example.com"}, true},
+		{Rule{Host: "blog.example.com"}, true},
+		{Rule{Host: "ample.com"}, false},
+		{Rule{Feed: "hacker", Title: "^Ask HN:"}, false},
+	}
+	for _, tt := range tests {
+		rs := RuleSet{Rules: []Rule{tt.rule}}
+		rs.Rules[0].Action = ActionRead
+		if err := rs.compile(); err != nil {
+			t.Fatalf("%+v: %v", tt.rule, err)
+		}
+		if got := rs.Rules[0].Match(&item); got != tt.want {
+			t.Errorf("%+v: Match = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestRuleSetApply(t *testing.T) {
+	rs := RuleSet{Rules: []Rule{
+		{Name: "prefix", Title: "^\\[Sponsored\\]", Action: ActionDrop},
+		{Name: "strip", Title: "^Show HN:", Action: ActionRewrite, Pattern: "^Show HN: (.*)$", Replace: "$1"},
+		{Name: "go", Category: "go", Action: ActionTag, Tags: []string{"go", "lang"}},
+		{Name: "star", Feed: "blog", Action: ActionStar},
+		{Name: "read", Title: "weekly", Action: ActionRead},
+	}}
+	if err := rs.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		item    FeedItem
+		want    FeedItem
+		matched []string
+		dropped bool
+	}{
+		{
+			item:    FeedItem{Title: "[Sponsored] Buy this", Feed: "Blog"},
+			want:    FeedItem{Title: "[Sponsored] Buy this", Feed: "Blog"},
+			matched: []string{"prefix"},
+			dropped: true,
+		},
+		{
+			item:    FeedItem{Title: "Show HN: Gophers", Feed: "HN", Categories: []string{"Go"}},
+			want:    FeedItem{Title: "Gophers", Feed: "HN", Categories: []string{"Go"}, Tags: []string{"go", "lang"}},
+			matched: []string{"strip", "go"},
+		},
+		{
+			item:    FeedItem{Title: "This weekly", Feed: "My Blog"},
+			want:    FeedItem{Title: "This weekly", Feed: "My Blog", Starred: true, Read: true},
+			matched: []string{"star", "read"},
+		},
+		{
+			item: FeedItem{Title: "Nothing", Feed: "HN"},
+			want: FeedItem{Title: "Nothing", Feed: "HN"},
+		},
+	}
+	for _, tt := range tests {
+		item := tt.item
+		res := rs.Apply(&item)
+		if res.Dropped != tt.dropped || !slices.Equal(res.Matched, tt.matched) {
+			t.Errorf("%q: result = %+v, want dropped %v, matched %q", tt.item.Title, res, tt.dropped, tt.matched)
+		}
+		if item.Title != tt.want.Title || item.Read != tt.want.Read || item.Starred != tt.want.Starred || !slices.Equal(item.Tags, tt.want.Tags) {
+			t.Errorf("%q: item = %+v, want %+v", tt.item.Title, item, tt.want)
+		}
+	}
+
+	var none *RuleSet
+	if res := none.Apply(&FeedItem{}); res.Dropped || len(res.Matched) != 0 {
+		t.Errorf("nil rule set: %+v", res)
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	tests := []string{
+		`{"rules": [{"action": "explode"}]}`,
+		`{"rules": [{"action": "tag"}]}`,
+		`{"rules": [{"action": "drop", "title": "("}]}`,
+		`{"rules": [{"action": "rewrite", "pattern": "["}]}`,
+		`{"rules": [`,
+	}
+	for _, data := range tests {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, rulesFile), []byte(data), 0644)
+		if _, err := LoadRules(dir); err == nil {
+			t.Errorf("%s: no error", data)
+		}
+	}
+
+	rs, err := LoadRules(t.TempDir())
+	if err != nil || len(rs.Rules) != 0 {
+		t.Errorf("missing file = %+v, %v; want no rules", rs, err)
+	}
+}
+
+func TestAddAppliesRules(t *testing.T) {
+	store := newTestStore(t, 10)
+	rs := &RuleSet{Rules: []Rule{{Title: "hour 1$", Action: ActionDrop}, {Action: ActionRead}}}
+	if err := rs.compile(); err != nil {
+		t.Fatal(err)
+	}
+	store.SetRules(rs)
+
+	added, err := store.Add([]FeedItem{testItem("Blog", 1), testItem("Blog", 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0].ID != "Blog-2" || !added[0].Read {
+		t.Errorf("added = %+v, want Blog-2 marked read", added)
+	}
+}
@@ -0,0 +1,210 @@
+// searches.go stores named searches that can be re-run with rss view
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// searchesFile is the name of the saved searches file in the data directory
+const searchesFile = "searches.json"
+
+// SavedSearch is a named combination of list filters. Since is a date
+// expression, usually relative (e.g. "7d") so the search keeps meaning
+// the same thing over time.
+type SavedSearch struct {
+	Name   string   `json:"name"`
+	Feed   string   `json:"feed,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Since  string   `json:"since,omitempty"`
+	Query  string   `json:"query,omitempty"`
+	Unread bool     `json:"unread,omitempty"`
+}
+
+// Options converts the search into list options relative to now
+func (ss SavedSearch) Options(now time.Time) (ListOptions, error) {
+	opts := ListOptions{
+		Feed:   ss.Feed,
+		Tags:   ss.Tags,
+		Query:  ss.Query,
+		Unread: ss.Unread,
+	}
+	if ss.Since != "" {
+		window, err := parseTimeRange(ss.Since, now)
+		if err != nil {
+			return opts, fmt.Errorf("search %s: since: %w", ss.Name, err)
+		}
+		opts.Since, opts.Until = window.From, window.Until
+	}
+	return opts, nil
+}
+
+// String describes the search's filters
+func (ss SavedSearch) String() string {
+	var parts []string
+	if ss.Feed != "" {
+		parts = append(parts, "feed="+ss.Feed)
+	}
+	if len(ss.Tags) > 0 {
+		parts = append(parts, "tag="+strings.Join(ss.Tags, ","))
+	}
+	if ss.Since != "" {
+		parts = append(parts, "since="+ss.Since)
+	}
+	if ss.Query != "" {
+		parts = append(parts, "query="+strconv.Quote(ss.Query))
+	}
+	if ss.Unread {
+		parts = append(parts, "unread")
+	}
+	if len(parts) == 0 {
+		return "(all items)"
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseSavedSearch builds a search from key=value arguments, e.g.
+// feed=Go tag=work,go since=168h query=release unread
+func parseSavedSearch(name string, args []string) (SavedSearch, error) {
+	ss := SavedSearch{Name: name}
+	for _, arg := range args {
+		key, value, _ := strings.Cut(arg, "=")
+		switch key {
+		case "feed":
+			ss.Feed = value
+		case "tag", "tags":
+			ss.Tags = editTags(nil, strings.Split(value, ","))
+		case "since":
+			if _, err := parseTimeRange(value, time.Now()); err != nil {
+				return ss, fmt.Errorf("since: %w", err)
+			}
+			ss.Since = value
+		case "query":
+			ss.Query = value
+		case "unread":
+			ss.Unread = value == "" || value == "true"
+		default:
+			return ss, fmt.Errorf("unknown search field %q (want feed, tag, since, query or unread)", key)
+		}
+	}
+	return ss, nil
+}
+
+// loadSearches reads the saved searches from dir, keyed by name
+func loadSearches(dir string) (map[string]SavedSearch, error) {
+	searches := make(map[string]SavedSearch)
+
+	data, err := os.ReadFile(filepath.Join(dir, searchesFile))
+	if os.IsNotExist(err) {
+		return searches, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []SavedSearch
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: %w", searchesFile, err)
+	}
+	for _, ss := range list {
+		searches[ss.Name] = ss
+	}
+	return searches, nil
+}
+
+// saveSearches writes the saved searches to dir, sorted by name
+func saveSearches(dir string, searches map[string]SavedSearch) error {
+	list := make([]SavedSearch, 0, len(searches))
+	for _, ss := range searches {
+		list = append(list, ss)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write atomically
+	path := filepath.Join(dir, searchesFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// cmdView lists saved searches, runs one, or manages them:
+//
+//	rss view                          list saved searches
+//	rss view <name>                   show the items matching a search
+//	rss view save <name> [key=value]  create or replace a search
+//	rss view delete <name>            remove a search
+func cmdView(cfg *Config, store *FeedStore, args []string) error {
+	searches, err := loadSearches(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 0:
+		if len(searches) == 0 {
+			fmt.Println("No saved searches")
+			return nil
+		}
+		names := make([]string, 0, len(searches))
+		for name := range searches {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, searches[name])
+		}
+		return w.Flush()
+
+	case (args[0] == "save" || args[0] == "delete") && len(args) < 2:
+		return usagef("usage: rss view [<name> | save <name> [key=value...] | delete <name>]")
+
+	case args[0] == "save":
+		ss, err := parseSavedSearch(args[1], args[2:])
+		if err != nil {
+			return err
+		}
+		searches[ss.Name] = ss
+		if err := saveSearches(cfg.DataDir, searches); err != nil {
+			return err
+		}
+		fmt.Printf("Saved %s: %s\n", ss.Name, ss)
+		return nil
+
+	case args[0] == "delete" && len(args) == 2:
+		if _, ok := searches[args[1]]; !ok {
+			return fmt.Errorf("no saved search %q", args[1])
+		}
+		delete(searches, args[1])
+		return saveSearches(cfg.DataDir, searches)
+
+	case len(args) == 1:
+		ss, ok := searches[args[0]]
+		if !ok {
+			return fmt.Errorf("no saved search %q", args[0])
+		}
+		opts, err := ss.Options(time.Now())
+		if err != nil {
+			return err
+		}
+		return outputItems(cfg, store.ListWith(cfg.listOptions(opts)), true)
+	}
+
+	return usagef("usage: rss view [<name> | save <name> [key=value...] | delete <name>]")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseSavedSearch(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string // String of the search, "" for an error
+	}{
+		{nil, "(all items)"},
+		{[]string{"feed=Go Blog", "tag=Work,go", "since=7d", "query=release notes", "unread"}, `feed=Go Blog tag=go,work since=7d query="release notes" unread`},
+		{[]string{"tags=go", "unread=false"}, "tag=go"},
+		{[]string{"since=someday"}, ""},
+		{[]string{"colour=red"}, ""},
+	}
+	for _, tt := range tests {
+		ss, err := parseSavedSearch("s", tt.args)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%q: no error", tt.args)
+			}
+			continue
+		}
+		if err != nil || ss.String() != tt.want {
+			t.Errorf("%q = %q, %v; want %q", tt.args, ss.String(), err, tt.want)
+		}
+	}
+}
+
+func TestSavedSearchOptions(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	ss := SavedSearch{Name: "recent", Feed: "Go", Tags: []string{"go"}, Since: "7d", Query: "release", Unread: true}
+	opts, err := ss.Options(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Feed != "Go" || !slices.Equal(opts.Tags, []string{"go"}) || opts.Query != "release" || !opts.Unread {
+		t.Errorf("options = %+v", opts)
+	}
+	if want := now.Add(-7 * 24 * time.Hour); !opts.Since.Equal(want) {
+		t.Errorf("Since = %v, want %v", opts.Since, want)
+	}
+
+	if _, err := (SavedSearch{Name: "bad", Since: "someday"}).Options(now); err == nil {
+		t.Error("bad since: no error")
+	}
+}
+
+func TestSaveAndLoadSearches(t *testing.T) {
+	dir := t.TempDir()
+	searches := map[string]SavedSearch{
+		"work":   {Name: "work", Tags: []string{"work"}},
+		"unread": {Name: "unread", Unread: true},
+	}
+	if err := saveSearches(dir, searches); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadSearches(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["work"].String() != "tag=work" || !got["unread"].Unread {
+		t.Errorf("loaded %+v", got)
+	}
+
+	if got, err := loadSearches(t.TempDir()); err != nil || len(got) != 0 {
+		t.Errorf("missing file = %+v, %v; want no searches", got, err)
+	}
+}
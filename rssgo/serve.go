@@ -0,0 +1,377 @@
+// serve.go publishes the store as aggregated Atom, RSS and JSON feeds
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// feedFormats maps served file extensions to their writer and MIME type
+var feedFormats = map[string]struct {
+	write       func(io.Writer, feedInfo, []FeedItem) error
+	contentType string
+}{
+	"atom": {writeAtom, "application/atom+xml; charset=utf-8"},
+	"rss":  {writeRSS, "application/rss+xml; charset=utf-8"},
+	"json": {writeJSONFeed, "application/feed+json; charset=utf-8"},
+}
+
+// defaultServeLimit is how many items a served feed holds unless ?limit=
+// asks otherwise
+const defaultServeLimit = 100
+
+// feedServer serves the aggregate feeds over HTTP
+type feedServer struct {
+	store   *FeedStore
+	dataDir string
+	proxies []*net.IPNet // reverse proxies whose X-Forwarded-Proto is trusted
+}
+
+// serveOptions are the flags of rss serve
+type serveOptions struct {
+	addr         string
+	watch        time.Duration
+	token        string
+	trustProxies []string
+}
+
+// register adds the serve flags to fs
+func (o *serveOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.addr, "addr", "127.0.0.1:8080", "Address to listen on; other than loopback needs --token")
+	fs.DurationVar(&o.watch, "watch", 0, "Refresh all subscriptions at this interval (0 disables)")
+	fs.StringVar(&o.token, "token", os.Getenv("RSS_API_TOKEN"), "Bearer token required by the /api/ endpoints")
+	fs.StringSliceVar(&o.trustProxies, "trust-proxy", nil, "Reverse proxy addresses or CIDR ranges whose X-Forwarded-Proto is honoured")
+}
+
+// runServer runs the feed server and JSON API until interrupted, optionally
+// refreshing subscriptions in the background
+func runServer(cfg *Config, store *FeedStore, opts serveOptions) error {
+	// The API can change subscriptions and items, so it is only served
+	// unauthenticated to this machine
+	if opts.token == "" && !isLoopbackAddr(opts.addr) {
+		return usagef("--addr %s is reachable from other machines; set --token (or RSS_API_TOKEN) to protect the API", opts.addr)
+	}
+	proxies, err := parseProxies(opts.trustProxies)
+	if err != nil {
+		return usagef("--trust-proxy: %v", err)
+	}
+	registerSecret(opts.token)
+
+	fetcher, err := newConfiguredFetcher(cfg, store)
+	if err != nil {
+		return err
+	}
+
+	mux := newServeMux(store, cfg.DataDir, proxies)
+	mux.Handle("/api/", &apiServer{store: store, fetcher: fetcher, token: opts.token})
+
+	if opts.watch > 0 {
+		bp := NewBatchProcessor(fetcher, 5, opts.watch)
+		go bp.Start(context.Background(), nil)
+		defer bp.Stop()
+	}
+
+	srv := &http.Server{
+		Addr:              opts.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return listenUntilSignal(srv)
+}
+
+// isLoopbackAddr reports whether addr only listens on the loopback
+// interface. An empty host listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// newServeMux returns the handler for everything rss serve exposes
+func newServeMux(store *FeedStore, dataDir string, proxies []*net.IPNet) *http.ServeMux {
+	fsrv := &feedServer{store: store, dataDir: dataDir, proxies: proxies}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", fsrv.handleIndex)
+	mux.HandleFunc("/feeds/", fsrv.handleFeed)
+	mux.HandleFunc("/tags/", fsrv.handleFeed)
+	mux.HandleFunc("/views/", fsrv.handleFeed)
+	return mux
+}
+
+// listenUntilSignal serves srv until SIGINT or SIGTERM, then shuts down
+// gracefully
+func listenUntilSignal(srv *http.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(os.Stderr, "Listening on %s\n", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleFeed serves /feed.EXT, /feeds/NAME.EXT, /tags/TAG.EXT and
+// /views/NAME.EXT
+func (s *feedServer) handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Split the escaped path so feed names may contain slashes
+	dir, file := path.Split(r.URL.EscapedPath())
+	ext := strings.TrimPrefix(path.Ext(file), ".")
+	format, ok := feedFormats[ext]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	name, err := url.PathUnescape(strings.TrimSuffix(file, "."+ext))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	limit := defaultServeLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts := ListOptions{Limit: limit, Reverse: true}
+	var title string
+	switch dir {
+	case "/":
+		if name != "feed" {
+			http.NotFound(w, r)
+			return
+		}
+		title = "All items"
+	case "/feeds/":
+		opts.FeedTitle = name
+		title = name
+	case "/tags/":
+		opts.Tags = []string{name}
+		title = "Tagged " + name
+	case "/views/":
+		searches, err := loadSearches(s.dataDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ss, ok := searches[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if opts, err = ss.Options(time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		opts.Limit, opts.Reverse = limit, true
+		title = "View " + name
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	items := s.store.ListWith(opts)
+	info := feedInfo{
+		Title:   title,
+		SelfURL: s.requestURL(r),
+		HomeURL: s.baseURL(r) + "/",
+		Updated: latestAdded(items),
+	}
+
+	var buf bytes.Buffer
+	if err := format.write(&buf, info, items); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveBytes(w, r, format.contentType, info.Updated, buf.Bytes())
+}
+
+// serveBytes writes body with a content-derived ETag and Last-Modified,
+// answering conditional requests with 304 Not Modified
+func serveBytes(w http.ResponseWriter, r *http.Request, contentType string, modified time.Time, body []byte) {
+	sum := sha256.Sum256(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", modified, bytes.NewReader(body))
+}
+
+// baseURL returns the scheme and host the request was addressed to.
+// X-Forwarded-Proto is only believed from a configured reverse proxy;
+// any other client could set it.
+func (s *feedServer) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); (proto == "http" || proto == "https") && s.fromProxy(r) {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// fromProxy reports whether r comes from one of the trusted proxies
+func (s *feedServer) fromProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, n := range s.proxies {
+		if ip != nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxies parses IP addresses and CIDR ranges
+func parseProxies(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range list {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", p)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// requestURL returns the absolute URL of r
+func (s *feedServer) requestURL(r *http.Request) string {
+	return s.baseURL(r) + r.URL.RequestURI()
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>RSS aggregate</title></head>
+<body>
+<h1>RSS aggregate</h1>
+<p>Every feed is available as <code>.atom</code>, <code>.rss</code> and <code>.json</code>; add <code>?limit=N</code> to change the number of items.</p>
+<h2>All items</h2>
+<ul><li><a href="/feed.atom">Atom</a> · <a href="/feed.rss">RSS</a> · <a href="/feed.json">JSON</a></li></ul>
+{{define "links"}}<ul>{{range .}}<li>{{.Name}}: <a href="{{.Path}}.atom">Atom</a> · <a href="{{.Path}}.rss">RSS</a> · <a href="{{.Path}}.json">JSON</a></li>{{end}}</ul>{{end}}
+{{with .Feeds}}<h2>Feeds</h2>{{template "links" .}}{{end}}
+{{with .Tags}}<h2>Tags</h2>{{template "links" .}}{{end}}
+{{with .Views}}<h2>Saved searches</h2>{{template "links" .}}{{end}}
+</body></html>
+`))
+
+// indexLink is one row of the index page
+type indexLink struct {
+	Name string
+	Path string
+}
+
+// handleIndex lists the available feeds, and serves /feed.EXT
+func (s *feedServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		s.handleFeed(w, r)
+		return
+	}
+
+	var data struct {
+		Feeds, Tags, Views []indexLink
+	}
+
+	feeds := make(map[string]bool)
+	for _, item := range s.store.ListWith(ListOptions{}) {
+		feeds[item.Feed] = true
+	}
+	data.Feeds = indexLinks("/feeds/", feeds)
+
+	tags := make(map[string]bool)
+	for tag := range s.store.Tags() {
+		tags[tag] = true
+	}
+	data.Tags = indexLinks("/tags/", tags)
+
+	searches, err := loadSearches(s.dataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	views := make(map[string]bool)
+	for name := range searches {
+		views[name] = true
+	}
+	data.Views = indexLinks("/views/", views)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, data)
+}
+
+// indexLinks returns sorted links for names under prefix
+func indexLinks(prefix string, names map[string]bool) []indexLink {
+	links := make([]indexLink, 0, len(names))
+	for name := range names {
+		links = append(links, indexLink{Name: name, Path: prefix + url.PathEscape(name)})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Name < links[j].Name
+	})
+	return links
+}
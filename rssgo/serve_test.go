@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080": true,
+		"localhost:8080": true,
+		"[::1]:8080":     true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"[::]:8080":      false,
+		"192.0.2.1:8080": false,
+		"example.com:80": false,
+		"8080":           false,
+	}
+	for addr, want := range tests {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestHandleFeedExactTitle(t *testing.T) {
+	store := newTestStore(t, 10)
+	if _, err := store.Add([]FeedItem{testItem("Go", 1), testItem("Go Weekly", 2), testItem("Golang News", 3)}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newServeMux(store, t.TempDir(), nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/feeds/Go.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var feed struct {
+		Items []struct {
+			Title string `json:"title"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Items) != 1 || feed.Items[0].Title != "Go at hour 1" {
+		t.Errorf("/feeds/Go.json items = %+v, want only the Go feed", feed.Items)
+	}
+}
+
+func TestBaseURLForwardedProto(t *testing.T) {
+	proxies, err := parseProxies([]string{"10.0.0.5", "192.0.2.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &feedServer{proxies: proxies}
+	tests := []struct {
+		remote, proto, want string
+	}{
+		{"10.0.0.5:4000", "https", "https://rss.test"},
+		{"192.0.2.77:4000", "https", "https://rss.test"},
+		{"203.0.113.9:4000", "https", "http://rss.test"},
+		{"10.0.0.5:4000", "javascript", "http://rss.test"},
+		{"10.0.0.5:4000", "", "http://rss.test"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "http://rss.test/feed.atom", nil)
+		r.RemoteAddr = tt.remote
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		if got := s.baseURL(r); got != tt.want {
+			t.Errorf("%s with X-Forwarded-Proto %q: baseURL = %s, want %s", tt.remote, tt.proto, got, tt.want)
+		}
+	}
+
+	if _, err := parseProxies([]string{"proxy.internal"}); err == nil {
+		t.Error("parseProxies accepted a host name")
+	}
+}
+
+func TestServeFeedRoutes(t *testing.T) {
+	store := newTestStore(t, 10)
+	if _, err := store.Add([]FeedItem{testItem("Go Blog", 1), testItem("News", 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Update("News-2", func(item *FeedItem) { item.Tags = []string{"work"} }); err != nil {
+		t.Fatal(err)
+	}
+	dataDir := t.TempDir()
+	if err := saveSearches(dataDir, map[string]SavedSearch{"go": {Name: "go", Feed: "Go"}}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newServeMux(store, dataDir, nil))
+	defer srv.Close()
+
+	tests := []struct {
+		method, path string
+		status       int
+		contentType  string
+		contains     string
+	}{
+		{"GET", "/", 200, "text/html", "/feeds/Go%20Blog"},
+		{"GET", "/feed.atom", 200, "application/atom+xml", "News at hour 2"},
+		{"GET", "/feed.rss", 200, "application/rss+xml", "Go Blog at hour 1"},
+		{"GET", "/feed.json", 200, "application/feed+json", "News at hour 2"},
+		{"GET", "/feeds/Go%20Blog.json", 200, "application/feed+json", "Go Blog at hour 1"},
+		{"GET", "/tags/work.rss", 200, "application/rss+xml", "News at hour 2"},
+		{"GET", "/views/go.atom", 200, "application/atom+xml", "Go Blog at hour 1"},
+		{"GET", "/views/missing.atom", 404, "", ""},
+		{"GET", "/feed.yaml", 404, "", ""},
+		{"GET", "/other.atom", 404, "", ""},
+		{"GET", "/feed.atom?limit=x", 400, "", ""},
+		{"POST", "/feed.atom", 405, "", ""},
+		{"HEAD", "/feed.json", 200, "application/feed+json", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+			continue
+		}
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+			t.Errorf("%s %s: Content-Type %q, want %s", tt.method, tt.path, ct, tt.contentType)
+		}
+		if !strings.Contains(string(body), tt.contains) {
+			t.Errorf("%s %s: body lacks %q", tt.method, tt.path, tt.contains)
+		}
+	}
+}
+
+func TestServeFeedConditional(t *testing.T) {
+	store := newTestStore(t, 10)
+	if _, err := store.Add([]FeedItem{testItem("Blog", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newServeMux(store, t.TempDir(), nil))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/feed.atom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Last-Modified") == "" {
+		t.Fatalf("validators missing: %v", resp.Header)
+	}
+
+	req, _ := http.NewRequest("GET", srv.URL+"/feed.atom", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("unchanged feed: status %d, want 304", resp.StatusCode)
+	}
+
+	// A new item changes the document and its ETag
+	if _, err := store.Add([]FeedItem{testItem("Blog", 2)}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("changed feed: status %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,165 @@
+// tags.go lets users organise stored items with tags
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Find returns the item whose ID is ref, or whose ID uniquely starts with
+// or ends with ref, so long GUIDs need not be typed in full
+func (s *FeedStore) Find(ref string) (FeedItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, err := s.find(ref)
+	if err != nil {
+		return FeedItem{}, err
+	}
+	return s.items[i], nil
+}
+
+// Has reports whether an item with exactly this ID is stored
+func (s *FeedStore) Has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, item := range s.items {
+		if item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the index of the item matching ref; the caller must hold s.mu
+func (s *FeedStore) find(ref string) (int, error) {
+	if ref == "" {
+		return -1, fmt.Errorf("empty item id")
+	}
+
+	match := -1
+	for i, item := range s.items {
+		if item.ID == ref {
+			return i, nil
+		}
+		if strings.HasPrefix(item.ID, ref) || strings.HasSuffix(item.ID, ref) {
+			if match >= 0 {
+				return -1, fmt.Errorf("item id %q is ambiguous", ref)
+			}
+			match = i
+		}
+	}
+	if match < 0 {
+		return -1, fmt.Errorf("no item with id %q", ref)
+	}
+	return match, nil
+}
+
+// Update applies fn to the item identified by ref and saves the store
+func (s *FeedStore) Update(ref string, fn func(item *FeedItem)) (FeedItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.find(ref)
+	if err != nil {
+		return FeedItem{}, err
+	}
+	fn(&s.items[i])
+
+	return s.items[i], s.save()
+}
+
+// SetRead sets the read flag of the items with the given IDs and saves
+// the store once
+func (s *FeedStore) SetRead(ids []string, read bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	for i := range s.items {
+		if want[s.items[i].ID] {
+			s.items[i].Read = read
+		}
+	}
+	return s.save()
+}
+
+// Tags returns every tag in use with the number of items carrying it
+func (s *FeedStore) Tags() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, item := range s.items {
+		for _, tag := range item.Tags {
+			counts[tag]++
+		}
+	}
+	return counts
+}
+
+// editTags adds the tags in spec to tags, or removes those prefixed with
+// "-". Tags are lowercased, deduplicated and kept sorted.
+func editTags(tags []string, spec []string) []string {
+	set := make(map[string]bool)
+	for _, t := range tags {
+		set[t] = true
+	}
+	for _, t := range spec {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch {
+		case t == "" || t == "-":
+		case strings.HasPrefix(t, "-"):
+			delete(set, t[1:])
+		default:
+			set[t] = true
+		}
+	}
+
+	result := make([]string, 0, len(set))
+	for t := range set {
+		result = append(result, t)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// cmdTag adds or removes tags on an item: rss tag <id> work,go,-later.
+// Without tags it prints the item's tags; without an id it lists all tags.
+func cmdTag(cfg *Config, store *FeedStore, args []string) error {
+	if len(args) == 0 {
+		counts := store.Tags()
+		if len(counts) == 0 {
+			fmt.Println("No tags")
+			return nil
+		}
+		names := make([]string, 0, len(counts))
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%-20s %d\n", name, counts[name])
+		}
+		return nil
+	}
+
+	var spec []string
+	for _, arg := range args[1:] {
+		spec = append(spec, strings.Split(arg, ",")...)
+	}
+
+	item, err := store.Update(args[0], func(item *FeedItem) {
+		item.Tags = editTags(item.Tags, spec)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\n  tags: %s\n", item.Title, strings.Join(item.Tags, ", "))
+	return nil
+}
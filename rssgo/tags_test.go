@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEditTags(t *testing.T) {
+	tests := []struct {
+		tags, spec []string
+		want       []string
+	}{
+		{nil, []string{"Work", "go"}, []string{"go", "work"}},
+		{[]string{"go", "work"}, []string{"-work"}, []string{"go"}},
+		{[]string{"go"}, []string{"go", " GO "}, []string{"go"}},
+		{[]string{"go"}, []string{"", "-", "-missing"}, []string{"go"}},
+		{[]string{"go"}, []string{"-go"}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := editTags(tt.tags, tt.spec); !slices.Equal(got, tt.want) {
+			t.Errorf("editTags(%q, %q) = %q, want %q", tt.tags, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	store := newTestStore(t, 10)
+	items := []FeedItem{testItem("Blog", 1), testItem("Blog", 2), testItem("News", 12)}
+	items[0].ID = "https://blog.test/posts/1"
+	items[1].ID = "https://blog.test/posts/2"
+	items[2].ID = "tag:news.test,2024:12"
+	if _, err := store.Add(items); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref  string
+		want string // ID, "" for an error
+	}{
+		{"https://blog.test/posts/1", "https://blog.test/posts/1"},
+		{"posts/2", "https://blog.test/posts/2"},
+		{"tag:news", "tag:news.test,2024:12"},
+		{"https://blog.test", ""}, // ambiguous
+		{"posts/3", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		item, err := store.Find(tt.ref)
+		if got := item.ID; got != tt.want || (err == nil) != (tt.want != "") {
+			t.Errorf("Find(%q) = %q, %v; want %q", tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestTagsFilterAndCount(t *testing.T) {
+	store := newTestStore(t, 10)
+	if _, err := store.Add([]FeedItem{testItem("Blog", 1), testItem("Blog", 2), testItem("Blog", 3)}); err != nil {
+		t.Fatal(err)
+	}
+	for ref, spec := range map[string][]string{"Blog-1": {"go", "work"}, "Blog-2": {"go"}} {
+		if _, err := store.Update(ref, func(item *FeedItem) { item.Tags = editTags(item.Tags, spec) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := store.Tags(); got["go"] != 2 || got["work"] != 1 || len(got) != 2 {
+		t.Errorf("Tags = %v", got)
+	}
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{[]string{"go"}, []string{"Blog-1", "Blog-2"}},
+		{[]string{"go", "work"}, []string{"Blog-1"}},
+		{[]string{"later"}, nil},
+	}
+	for _, tt := range tests {
+		if got := ids(store.ListWith(ListOptions{Tags: tt.tags})); !slices.Equal(got, tt.want) {
+			t.Errorf("tags %q: items = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+}
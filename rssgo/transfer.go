@@ -0,0 +1,125 @@
+// transfer.go handles compressed transfer and bandwidth accounting
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding lists the content codings the fetcher can decode.
+// Brotli is not offered: there is no decoder in the standard library and
+// we do not vendor one.
+const acceptEncoding = "gzip, deflate"
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// transferStats records the size of one response body before and after
+// content decoding
+type transferStats struct {
+	Encoding     string
+	Compressed   int64
+	Uncompressed int64
+}
+
+// decodedBody wraps a response body so it yields decoded bytes while
+// counting both the bytes on the wire and the bytes produced
+type decodedBody struct {
+	wire    *countingReader
+	decoded *countingReader
+	closer  io.Closer
+	enc     string
+}
+
+// newDecodedBody returns a reader for resp.Body that undoes the response's
+// Content-Encoding. Unknown encodings are an error rather than garbage
+// handed to the XML parser.
+func newDecodedBody(resp *http.Response) (*decodedBody, error) {
+	wire := &countingReader{r: resp.Body}
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	var r io.Reader
+	switch enc {
+	case "", "identity":
+		r = wire
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		r = zr
+	case "deflate":
+		// "deflate" is specified as zlib-wrapped, but some servers send
+		// raw deflate; peek at the header to tell them apart
+		br := bufio.NewReader(wire)
+		if hdr, err := br.Peek(2); err == nil && isZlibHeader(hdr) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("deflate: %w", err)
+			}
+			r = zr
+		} else {
+			r = flate.NewReader(br)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", enc)
+	}
+
+	return &decodedBody{
+		wire:    wire,
+		decoded: &countingReader{r: r},
+		closer:  resp.Body,
+		enc:     enc,
+	}, nil
+}
+
+func (d *decodedBody) Read(p []byte) (int, error) {
+	return d.decoded.Read(p)
+}
+
+func (d *decodedBody) Close() error {
+	return d.closer.Close()
+}
+
+// Stats returns the byte counts observed so far
+func (d *decodedBody) Stats() transferStats {
+	return transferStats{
+		Encoding:     d.enc,
+		Compressed:   d.wire.n,
+		Uncompressed: d.decoded.n,
+	}
+}
+
+// isZlibHeader reports whether hdr starts a zlib stream (RFC 1950)
+func isZlibHeader(hdr []byte) bool {
+	return hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0
+}
+
+// formatBytes formats n as a human readable size
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
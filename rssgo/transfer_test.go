@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compress encodes data with the content coding enc; "raw-deflate" is
+// deflate without the zlib wrapper
+func compress(t *testing.T, enc string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch enc {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	default:
+		return data
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecodedBody(t *testing.T) {
+	content := []byte(strings.Repeat("<item><title>compressible</title></item>\n", 100))
+	tests := []struct {
+		header string // Content-Encoding
+		coding string // how the body is encoded
+		want   string // recorded encoding
+	}{
+		{"", "", ""},
+		{"identity", "", "identity"},
+		{"gzip", "gzip", "gzip"},
+		{"X-Gzip", "gzip", "x-gzip"},
+		{"deflate", "deflate", "deflate"},
+		{"deflate", "raw-deflate", "deflate"},
+	}
+	for _, tt := range tests {
+		wire := compress(t, tt.coding, content)
+		resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(wire))}
+		if tt.header != "" {
+			resp.Header.Set("Content-Encoding", tt.header)
+		}
+		body, err := newDecodedBody(resp)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.header, tt.coding, err)
+		}
+		got, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.header, tt.coding, err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("%s/%s: decoded body differs", tt.header, tt.coding)
+		}
+		want := transferStats{Encoding: tt.want, Compressed: int64(len(wire)), Uncompressed: int64(len(content))}
+		if stats := body.Stats(); stats != want {
+			t.Errorf("%s/%s: stats = %+v, want %+v", tt.header, tt.coding, stats, want)
+		}
+	}
+}
+
+func TestDecodedBodyErrors(t *testing.T) {
+	for _, enc := range []string{"br", "compress"} {
+		resp := &http.Response{Header: http.Header{"Content-Encoding": {enc}}, Body: http.NoBody}
+		if _, err := newDecodedBody(resp); err == nil {
+			t.Errorf("%s: no error", enc)
+		}
+	}
+	resp := &http.Response{Header: http.Header{"Content-Encoding": {"gzip"}}, Body: io.NopCloser(strings.NewReader("not gzip"))}
+	if _, err := newDecodedBody(resp); err == nil {
+		t.Error("corrupt gzip: no error")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSavedPercent(t *testing.T) {
+	tests := []struct {
+		compressed, uncompressed int64
+		want                     string
+	}{
+		{0, 0, "-"},
+		{100, 100, "0%"},
+		{25, 100, "75%"},
+	}
+	for _, tt := range tests {
+		if got := savedPercent(tt.compressed, tt.uncompressed); got != tt.want {
+			t.Errorf("savedPercent(%d, %d) = %q, want %q", tt.compressed, tt.uncompressed, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRecordsTransferSizes(t *testing.T) {
+	feed, err := os.ReadFile(filepath.Join("testdata", "feeds", "rss2.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acceptEnc string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEnc = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compress(t, "gzip", feed))
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t, 10)
+	fetcher := NewFetcher(store)
+	for i := 0; i < 2; i++ {
+		if err := fetcher.FetchAll(context.Background(), []string{srv.URL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if acceptEnc != acceptEncoding {
+		t.Errorf("Accept-Encoding = %q, want %q", acceptEnc, acceptEncoding)
+	}
+	m, ok := store.MetaFor(srv.URL)
+	if !ok {
+		t.Fatal("no metadata for the feed")
+	}
+	wire := int64(len(compress(t, "gzip", feed)))
+	if m.Encoding != "gzip" || m.BytesCompressed != wire || m.BytesUncompressed != int64(len(feed)) {
+		t.Errorf("last fetch = %s %d/%d, want gzip %d/%d", m.Encoding, m.BytesCompressed, m.BytesUncompressed, wire, len(feed))
+	}
+	if m.Fetches != 2 || m.TotalCompressed != 2*wire || m.TotalUncompressed != 2*int64(len(feed)) {
+		t.Errorf("totals = %d fetches %d/%d, want 2 fetches %d/%d", m.Fetches, m.TotalCompressed, m.TotalUncompressed, 2*wire, 2*len(feed))
+	}
+}
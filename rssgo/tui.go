@@ -0,0 +1,571 @@
+// tui.go implements the interactive full-screen browser started by rss tui
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences used by the TUI
+const (
+	ansiAltScreen  = "\x1b[?1049h"
+	ansiMainScreen = "\x1b[?1049l"
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+	ansiHome       = "\x1b[H"
+	ansiClearLine  = "\x1b[K"
+	ansiReverse    = "\x1b[7m"
+	ansiBold       = "\x1b[1m"
+	ansiDim        = "\x1b[2m"
+	ansiReset      = "\x1b[0m"
+)
+
+// Key names produced by readKeys for escape sequences
+const (
+	keyUp       = "up"
+	keyDown     = "down"
+	keyLeft     = "left"
+	keyRight    = "right"
+	keyPageUp   = "pgup"
+	keyPageDown = "pgdn"
+	keyHome     = "home"
+	keyEnd      = "end"
+)
+
+// sidebarWidth is the width of the feed list in columns
+const sidebarWidth = 28
+
+// tuiFocus selects which pane receives navigation keys
+type tuiFocus int
+
+const (
+	focusFeeds tuiFocus = iota
+	focusItems
+	focusPreview
+)
+
+// defaultTUIWatch is how often rss tui refreshes all subscriptions in the
+// background unless --watch says otherwise
+const defaultTUIWatch = 15 * time.Minute
+
+// tui holds the state of the interactive browser
+type tui struct {
+	store   *FeedStore
+	fetcher *Fetcher
+	out     io.Writer
+	watch   time.Duration // background refresh interval, 0 for none
+
+	all   []FeedItem // every item, newest first
+	feeds []string   // feed titles; index 0 is "All feeds"
+	items []FeedItem // items of the selected feed
+
+	feed, item       int // selected feed and item
+	feedTop, itemTop int // first visible row of each list
+	previewTop       int // first visible line of the preview
+
+	focus      tuiFocus
+	width      int
+	height     int
+	status     string
+	refreshing bool
+}
+
+// cmdTUI starts the interactive browser, refreshing every watch
+func cmdTUI(cfg *Config, store *FeedStore, watch time.Duration, args []string) error {
+	if len(args) > 0 {
+		return usagef("tui takes no arguments")
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("rss tui needs an interactive terminal")
+	}
+
+	fetcher, err := newConfiguredFetcher(cfg, store)
+	if err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Print(ansiAltScreen + ansiHideCursor)
+	defer fmt.Print(ansiReset + ansiShowCursor + ansiMainScreen)
+
+	// Parse warnings from background refreshes would scribble over the
+	// screen
+	defer func(w io.Writer) { warnOutput = w }(warnOutput)
+	warnOutput = io.Discard
+
+	t := &tui{store: store, fetcher: fetcher, out: os.Stdout, watch: watch}
+	t.reload()
+	return t.run(os.Stdin)
+}
+
+// run is the event loop: it redraws after every key press, finished
+// refresh and terminal resize
+func (t *tui) run(in io.Reader) error {
+	// The reader stays blocked on in after run returns; done and the
+	// buffer let it drop keys instead of waiting for a receiver
+	done := make(chan struct{})
+	defer close(done)
+	keys := make(chan string, 16)
+	go readKeys(in, keys, done)
+
+	refreshed := make(chan error, 1)
+	resize := time.NewTicker(250 * time.Millisecond)
+	defer resize.Stop()
+
+	var watch <-chan time.Time
+	if t.watch > 0 {
+		ticker := time.NewTicker(t.watch)
+		defer ticker.Stop()
+		watch = ticker.C
+	}
+
+	t.width, t.height = terminalSize()
+	t.draw()
+
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || key == "q" || key == "\x03" {
+				return nil
+			}
+			if key == "R" {
+				t.startRefresh(refreshed)
+			} else {
+				t.handleKey(key)
+			}
+
+		case <-watch:
+			if t.refreshing {
+				continue
+			}
+			t.startRefresh(refreshed)
+
+		case err := <-refreshed:
+			t.refreshing = false
+			if err != nil {
+				t.status = "Refresh failed: " + redact(err.Error())
+			} else {
+				t.status = "Refreshed at " + time.Now().Format("15:04:05")
+			}
+			t.reload()
+
+		case <-resize.C:
+			w, h := terminalSize()
+			if w == t.width && h == t.height {
+				continue
+			}
+			t.width, t.height = w, h
+		}
+		t.draw()
+	}
+}
+
+// startRefresh refreshes all feeds in the background, reporting the result
+// on refreshed, unless a refresh is already running
+func (t *tui) startRefresh(refreshed chan<- error) {
+	if t.refreshing {
+		return
+	}
+	t.refreshing = true
+	t.status = "Refreshing feeds..."
+	go func() {
+		refreshed <- t.refresh()
+	}()
+}
+
+// refresh fetches every subscription
+func (t *tui) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	return t.fetcher.FetchAll(ctx, t.store.Subscriptions())
+}
+
+// reload re-reads items from the store, keeping the selection where
+// possible
+func (t *tui) reload() {
+	var selectedFeed, selectedItem string
+	if t.feed < len(t.feeds) {
+		selectedFeed = t.feeds[t.feed]
+	}
+	if t.item < len(t.items) {
+		selectedItem = t.items[t.item].ID
+	}
+
+	t.all = t.store.ListWith(ListOptions{Reverse: true})
+
+	seen := make(map[string]bool)
+	t.feeds = []string{"All feeds"}
+	var names []string
+	for _, item := range t.all {
+		if !seen[item.Feed] {
+			seen[item.Feed] = true
+			names = append(names, item.Feed)
+		}
+	}
+	sort.Strings(names)
+	t.feeds = append(t.feeds, names...)
+
+	t.feed = 0
+	for i, name := range t.feeds {
+		if name == selectedFeed {
+			t.feed = i
+		}
+	}
+	t.selectFeed()
+
+	for i, item := range t.items {
+		if item.ID == selectedItem {
+			t.item = i
+		}
+	}
+}
+
+// selectFeed fills t.items with the items of the selected feed
+func (t *tui) selectFeed() {
+	t.items = t.items[:0]
+	for _, item := range t.all {
+		if t.feed == 0 || item.Feed == t.feeds[t.feed] {
+			t.items = append(t.items, item)
+		}
+	}
+	t.item, t.itemTop, t.previewTop = 0, 0, 0
+}
+
+// unread returns the number of unread items in feed index i
+func (t *tui) unread(i int) int {
+	n := 0
+	for _, item := range t.all {
+		if !item.Read && (i == 0 || item.Feed == t.feeds[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+// handleKey applies a key press to the state
+func (t *tui) handleKey(key string) {
+	t.status = ""
+	listHeight := t.listHeight()
+
+	switch key {
+	case "\t":
+		t.focus = (t.focus + 1) % 3
+	case "h", keyLeft:
+		if t.focus > focusFeeds {
+			t.focus--
+		}
+	case "l", keyRight, "\r":
+		if t.focus < focusPreview {
+			t.focus++
+		}
+	case "j", keyDown:
+		t.move(1)
+	case "k", keyUp:
+		t.move(-1)
+	case " ", keyPageDown:
+		t.move(listHeight)
+	case "b", keyPageUp:
+		t.move(-listHeight)
+	case "g", keyHome:
+		t.move(-1 << 30)
+	case "G", keyEnd:
+		t.move(1 << 30)
+	case "r":
+		t.toggle(func(item *FeedItem) { item.Read = !item.Read })
+	case "s":
+		t.toggle(func(item *FeedItem) { item.Starred = !item.Starred })
+	case "o":
+		if item, ok := t.current(); ok {
+			if err := openBrowser(item.Link); err != nil {
+				t.status = err.Error()
+				return
+			}
+			if !item.Read {
+				t.toggle(func(item *FeedItem) { item.Read = true })
+			}
+			t.status = "Opened " + item.Link
+		}
+	case "?":
+		t.status = "j/k move  tab/h/l pane  r read  s star  o open  R refresh  q quit"
+	}
+}
+
+// move moves the selection in the focused pane by delta rows
+func (t *tui) move(delta int) {
+	switch t.focus {
+	case focusFeeds:
+		t.feed = clamp(t.feed+delta, 0, len(t.feeds)-1)
+		t.selectFeed()
+	case focusItems:
+		t.item = clamp(t.item+delta, 0, len(t.items)-1)
+		t.previewTop = 0
+	case focusPreview:
+		t.previewTop = clamp(t.previewTop+delta, 0, 1<<30)
+	}
+}
+
+// current returns the selected item
+func (t *tui) current() (FeedItem, bool) {
+	if t.item < 0 || t.item >= len(t.items) {
+		return FeedItem{}, false
+	}
+	return t.items[t.item], true
+}
+
+// toggle applies fn to the selected item in the store and in the view
+func (t *tui) toggle(fn func(item *FeedItem)) {
+	item, ok := t.current()
+	if !ok {
+		return
+	}
+	updated, err := t.store.Update(item.ID, fn)
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	t.items[t.item] = updated
+	for i := range t.all {
+		if t.all[i].ID == updated.ID {
+			t.all[i] = updated
+		}
+	}
+}
+
+// listHeight is the number of item rows shown above the preview
+func (t *tui) listHeight() int {
+	return max(3, (t.height-2)/2)
+}
+
+// draw renders the whole screen
+func (t *tui) draw() {
+	if t.width < sidebarWidth+20 || t.height < 8 {
+		fmt.Fprint(t.out, ansiHome+"Terminal too small"+ansiClearLine)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(ansiHome)
+
+	bodyHeight := t.height - 1
+	listHeight := t.listHeight()
+	mainWidth := t.width - sidebarWidth - 1
+
+	t.feedTop = scrollTo(t.feed, t.feedTop, bodyHeight)
+	t.itemTop = scrollTo(t.item, t.itemTop, listHeight-1)
+
+	preview := t.previewLines(mainWidth)
+	previewHeight := bodyHeight - listHeight - 1
+	t.previewTop = clamp(t.previewTop, 0, max(0, len(preview)-previewHeight))
+
+	for row := 0; row < bodyHeight; row++ {
+		// Sidebar
+		if i := t.feedTop + row; i >= 0 && i < len(t.feeds) {
+			label := fmt.Sprintf("%s (%d)", t.feeds[i], t.unread(i))
+			b.WriteString(t.styled(fit(label, sidebarWidth), i == t.feed, t.focus == focusFeeds))
+		} else {
+			b.WriteString(strings.Repeat(" ", sidebarWidth))
+		}
+		b.WriteString(ansiDim + "│" + ansiReset)
+
+		// Item list, separator, preview
+		switch {
+		case row == 0:
+			b.WriteString(ansiBold + fit(fmt.Sprintf(" %s — %d items", t.feeds[t.feed], len(t.items)), mainWidth) + ansiReset)
+		case row < listHeight:
+			if i := t.itemTop + row - 1; i >= 0 && i < len(t.items) {
+				b.WriteString(t.styled(fit(itemLine(t.items[i], t.feed == 0), mainWidth), i == t.item, t.focus == focusItems))
+			}
+		case row == listHeight:
+			b.WriteString(ansiDim + strings.Repeat("─", mainWidth) + ansiReset)
+		default:
+			if i := t.previewTop + row - listHeight - 1; i >= 0 && i < len(preview) {
+				b.WriteString(fit(preview[i], mainWidth))
+			}
+		}
+		b.WriteString(ansiClearLine + "\r\n")
+	}
+
+	status := t.status
+	if status == "" {
+		status = "? help  q quit"
+	}
+	b.WriteString(ansiReverse + fit(" "+status, t.width) + ansiReset)
+
+	fmt.Fprint(t.out, b.String())
+}
+
+// styled highlights the selected row, more strongly in the focused pane
+func (t *tui) styled(s string, selected, focused bool) string {
+	switch {
+	case selected && focused:
+		return ansiReverse + s + ansiReset
+	case selected:
+		return ansiBold + s + ansiReset
+	}
+	return s
+}
+
+// previewLines renders the selected item for the preview pane
+func (t *tui) previewLines(width int) []string {
+	item, ok := t.current()
+	if !ok {
+		return []string{"No items"}
+	}
+
+	lines := wrapText(item.Title, width)
+	lines = append(lines,
+		fmt.Sprintf("%s · %s", item.Feed, item.Published.Format("2006-01-02 15:04")))
+	if item.Author != "" {
+		lines = append(lines, "By "+item.Author)
+	}
+	if len(item.Tags) > 0 {
+		lines = append(lines, "#"+strings.Join(item.Tags, " #"))
+	}
+	lines = append(lines, item.Link, "")
+	lines = append(lines, strings.Split(contentText(item, width, false), "\n")...)
+	return lines
+}
+
+// itemLine formats an item for the list pane
+func itemLine(item FeedItem, showFeed bool) string {
+	flags := []rune("  ")
+	if !item.Read {
+		flags[0] = '●'
+	}
+	if item.Starred {
+		flags[1] = '★'
+	}
+	line := fmt.Sprintf(" %s %s  %s", string(flags), item.Published.Format("01-02 15:04"), item.Title)
+	if showFeed {
+		line += "  — " + item.Feed
+	}
+	return line
+}
+
+// readKeys reads key presses from in and sends them to keys, translating
+// common escape sequences. It closes keys when in is exhausted, and stops
+// once done is closed.
+func readKeys(in io.Reader, keys chan<- string, done <-chan struct{}) {
+	defer close(keys)
+	send := func(key string) bool {
+		select {
+		case keys <- key:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	sequences := map[string]string{
+		"\x1b[A": keyUp, "\x1b[B": keyDown, "\x1b[C": keyRight, "\x1b[D": keyLeft,
+		"\x1bOA": keyUp, "\x1bOB": keyDown, "\x1bOC": keyRight, "\x1bOD": keyLeft,
+		"\x1b[5~": keyPageUp, "\x1b[6~": keyPageDown,
+		"\x1b[H": keyHome, "\x1b[F": keyEnd, "\x1b[1~": keyHome, "\x1b[4~": keyEnd,
+	}
+
+	buf := make([]byte, 64)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		chunk := string(buf[:n])
+		if strings.HasPrefix(chunk, "\x1b") {
+			if key, ok := sequences[chunk]; ok && !send(key) {
+				return
+			}
+			continue
+		}
+		for _, r := range chunk {
+			if !send(string(r)) {
+				return
+			}
+		}
+	}
+}
+
+// terminalSize returns the size of the terminal on stdout
+func terminalSize() (int, int) {
+	w, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 80, 24
+	}
+	return w, h
+}
+
+// scrollTo returns the first visible row so that selected stays within a
+// window of height rows starting at top
+func scrollTo(selected, top, height int) int {
+	if height <= 0 {
+		return 0
+	}
+	if selected < top {
+		return max(selected, 0)
+	}
+	if selected >= top+height {
+		return selected - height + 1
+	}
+	return top
+}
+
+// fit truncates or pads s to exactly width columns
+func fit(s string, width int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return ' '
+		}
+		return r
+	}, s)
+	n := utf8.RuneCountInString(s)
+	if n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	runes := []rune(s)
+	return string(runes[:width-1]) + "…"
+}
+
+// wrapText breaks s into lines of at most width columns at spaces
+func wrapText(s string, width int) []string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	line := words[0]
+	for _, w := range words[1:] {
+		if utf8.RuneCountInString(line)+1+utf8.RuneCountInString(w) > width {
+			lines = append(lines, line)
+			line = w
+			continue
+		}
+		line += " " + w
+	}
+	return append(lines, line)
+}
+
+// clamp limits v to lo..hi; an empty range (hi < lo), as for an empty
+// list, yields lo
+func clamp(v, lo, hi int) int {
+	if v < lo || hi < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTUIEmptyStore(t *testing.T) {
+	ui := &tui{store: newTestStore(t, 10), out: io.Discard, width: 100, height: 30}
+	ui.reload()
+	for _, key := range []string{"\t", "j", "k", "G", "g", "\t", "j", "k"} {
+		ui.handleKey(key)
+		if ui.item != 0 {
+			t.Fatalf("after %q: item = %d on an empty list", key, ui.item)
+		}
+		ui.draw()
+	}
+}
+
+func TestBrowserCommand(t *testing.T) {
+	tests := []struct {
+		browser string
+		want    []string
+	}{
+		{"firefox", []string{"firefox", "https://x.test/"}},
+		{":lynx -dump %s", []string{"lynx", "-dump", "https://x.test/"}},
+		{"  :w3m", []string{"w3m", "https://x.test/"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("BROWSER", tt.browser)
+		cmd := browserCommand("https://x.test/")
+		if got := cmd.Args; !slices.Equal(got, tt.want) {
+			t.Errorf("BROWSER=%q: args = %q, want %q", tt.browser, got, tt.want)
+		}
+	}
+}
+
+func TestTUIWatchRefreshes(t *testing.T) {
+	srv := newFakeFeedServer(t)
+	store := newTestStore(t, 10)
+	fetcher := NewFetcher(store)
+	feed := srv.URLFor("/feed/rss2.xml")
+	if err := fetcher.FetchAll(context.Background(), []string{feed}); err != nil {
+		t.Fatal(err)
+	}
+
+	in, keys := io.Pipe()
+	ui := &tui{store: store, fetcher: fetcher, out: io.Discard, watch: 10 * time.Millisecond}
+	ui.reload()
+	done := make(chan error, 1)
+	go func() { done <- ui.run(in) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Requests("/feed/rss2.xml") < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := srv.Requests("/feed/rss2.xml"); n < 3 {
+		t.Errorf("%d requests, want background refreshes", n)
+	}
+	keys.Write([]byte("q"))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadKeysStopsWhenDone(t *testing.T) {
+	keys := make(chan string)
+	done := make(chan struct{})
+	close(done)
+	finished := make(chan struct{})
+	go func() {
+		readKeys(strings.NewReader("jjjj"), keys, done)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("readKeys still waiting for a receiver after done")
+	}
+}
+
+// chunkReader returns one chunk per Read, as a terminal in raw mode does
+// for each key press
+type chunkReader []string
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, (*r)[0])
+	*r = (*r)[1:]
+	return n, nil
+}
+
+func TestReadKeys(t *testing.T) {
+	in := chunkReader{"j", "\x1b[B", "\x1bOA", "\x1b[5~", "\x1b[Z", "gq"}
+	keys := make(chan string, 16)
+	readKeys(&in, keys, make(chan struct{}))
+	var got []string
+	for key := range keys {
+		got = append(got, key)
+	}
+	want := []string{"j", keyDown, keyUp, keyPageUp, "g", "q"}
+	if !slices.Equal(got, want) {
+		t.Errorf("keys = %q, want %q", got, want)
+	}
+}